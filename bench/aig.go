@@ -0,0 +1,158 @@
+package bench
+
+// An and-inverter graph, using AIGER's numbering: literal 2v is variable v
+// and 2v+1 is its inverse, with variable 0 being the constant false. Inputs
+// come first, then latches, then AND gates.
+type aig struct {
+	nInputs  int
+	nLatches int
+
+	// The two inputs of each AND gate, in the order they were made
+	ands [][2]int
+
+	// Structural hashing, so the same AND is never made twice
+	hash map[[2]int]int
+
+	// The literal for the value each latch takes next
+	next []int
+}
+
+func newAIG(nInputs, nLatches int) *aig {
+	return &aig{nInputs: nInputs, nLatches: nLatches, hash: make(map[[2]int]int)}
+}
+
+func (g *aig) input(i int) int {
+	return 2 * (i + 1)
+}
+
+func (g *aig) latch(i int) int {
+	return 2 * (g.nInputs + i + 1)
+}
+
+func (g *aig) maxVar() int {
+	return g.nInputs + g.nLatches + len(g.ands)
+}
+
+func negate(a int) int {
+	return a ^ 1
+}
+
+// Returns the literal for a AND b, folding away constants and trivial cases
+func (g *aig) and(a, b int) int {
+	if a < b {
+		a, b = b, a
+	}
+	switch {
+	case b == 0 || a == negate(b):
+		return 0
+	case b == 1 || a == b:
+		return a
+	}
+	if lit, ok := g.hash[[2]int{a, b}]; ok {
+		return lit
+	}
+	g.ands = append(g.ands, [2]int{a, b})
+	lit := 2 * g.maxVar()
+	g.hash[[2]int{a, b}] = lit
+	return lit
+}
+
+func (g *aig) or(a, b int) int {
+	return negate(g.and(negate(a), negate(b)))
+}
+
+func (g *aig) xor(a, b int) int {
+	return g.or(g.and(a, negate(b)), g.and(negate(a), b))
+}
+
+// A sum of products for the truth table, which is false if it's never on
+func (g *aig) lut(mask uint64, ins []int) int {
+	lit := 0
+	for _, c := range lutCover(mask, len(ins), true) {
+		term := 1
+		for i, in := range ins {
+			if c.care&(1<<uint(i)) == 0 {
+				continue
+			}
+			if c.value&(1<<uint(i)) == 0 {
+				in = negate(in)
+			}
+			term = g.and(term, in)
+		}
+		lit = g.or(lit, term)
+	}
+	return lit
+}
+
+// Reduces the literals down to one, two at a time
+func (g *aig) fold(lits []int, op func(a, b int) int) int {
+	lit := lits[0]
+	for _, l := range lits[1:] {
+		lit = op(lit, l)
+	}
+	return lit
+}
+
+// Builds the AIG for a circuit, returning it along with the literal for the
+// output of each gate, indexed by gate ID
+func (b *Bench) toAIG() (*aig, []int) {
+	g := newAIG(len(b.inputs), len(b.ffs))
+	lits := make([]int, len(b.toInputs))
+	for i, id := range b.inputs {
+		lits[id] = g.input(i)
+	}
+	for i, id := range b.ffs {
+		lits[id] = g.latch(i)
+	}
+
+	for _, id := range b.topoOrder() {
+		ins := make([]int, len(b.toInputs[id]))
+		for i, in := range b.toInputs[id] {
+			ins[i] = lits[in]
+		}
+
+		gt := b.gateType[id]
+		switch {
+		case gt.and:
+			lits[id] = g.fold(ins, g.and)
+		case gt.nand:
+			lits[id] = negate(g.fold(ins, g.and))
+		case gt.or:
+			lits[id] = g.fold(ins, g.or)
+		case gt.nor:
+			lits[id] = negate(g.fold(ins, g.or))
+		case gt.xor:
+			lits[id] = g.fold(ins, g.xor)
+		case gt.xnor:
+			lits[id] = negate(g.fold(ins, g.xor))
+		case gt.not:
+			lits[id] = negate(ins[0])
+		case gt.buff:
+			lits[id] = ins[0]
+		case gt.mux:
+			lits[id] = g.or(g.and(negate(ins[0]), ins[1]), g.and(ins[0], ins[2]))
+		case gt.lut:
+			lits[id] = g.lut(b.luts[id], ins)
+		case gt.const0:
+			lits[id] = 0
+		case gt.const1:
+			lits[id] = 1
+		}
+	}
+
+	for _, id := range b.ffs {
+		d := lits[b.toInputs[id][0]]
+		gt := b.gateType[id]
+		switch {
+		case gt.enable:
+			ctl := lits[b.toInputs[id][1]]
+			d = g.or(g.and(negate(ctl), lits[id]), g.and(ctl, d))
+		case gt.reset:
+			d = g.and(d, negate(lits[b.toInputs[id][1]]))
+		case gt.set:
+			d = g.or(d, lits[b.toInputs[id][1]])
+		}
+		g.next = append(g.next, d)
+	}
+	return g, lits
+}
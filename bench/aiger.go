@@ -0,0 +1,355 @@
+package bench
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// The kinds of problems we can run into reading an AIGER file, on top of the
+// ones checkLines looks for
+var (
+	ErrAIGERHeader      = errors.New("malformed AIGER header")
+	ErrAIGERLiteral     = errors.New("malformed AIGER literal")
+	ErrAIGERUnsupported = errors.New("unsupported AIGER feature")
+)
+
+// NewAIGER reads an and-inverter graph in either the ASCII (aag) or binary
+// (aig) AIGER format from r. Latches become flip flops, with their reset
+// values as the initial state, and both outputs and bad state properties
+// become OUTPUT ports. Uninitialized latches can start with either value. Bad
+// state properties are named b0, b1, etc. unless the symbol table says
+// otherwise.
+func NewAIGER(r io.Reader, goal string, opts ...Option) (*Bench, error) {
+	bench := newBench(goal, opts)
+	a := &aigerReader{r: bufio.NewReader(r), name: bench.name}
+	if err := a.read(); err != nil {
+		return nil, err
+	}
+
+	bench.lines = a.fileLines()
+	bench.defaultInit(a.init)
+	if err := bench.load(); err != nil {
+		return nil, err
+	}
+	return bench, nil
+}
+
+type aigerReader struct {
+	r    *bufio.Reader
+	name string
+	// The line we're on, for error messages
+	num int
+
+	binary bool
+	// Header counts: max variable, inputs, latches, outputs, ANDs, bad states
+	m, i, l, o, a, b int
+
+	// Literals for each section of the file
+	inputs  []int
+	latches [][2]int
+	outputs []int
+	bad     []int
+	ands    [][3]int
+
+	// The initial value of each latch
+	init string
+
+	// From the symbol table, indexed by section letter and position
+	symbols map[string]string
+
+	// Net names we've handed out, by variable, and which names are taken
+	names []string
+	used  map[string]bool
+}
+
+func (a *aigerReader) lineErr(text string, err error) error {
+	return &ParseError{File: a.name, Line: a.num, Text: text, Err: err}
+}
+
+func (a *aigerReader) readLine() (string, error) {
+	line, err := a.r.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	a.num++
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+// Reads a line of whitespace separated literals, making sure there are
+// between min and max of them
+func (a *aigerReader) readLiterals(min, max int) ([]int, error) {
+	line, err := a.readLine()
+	if err != nil {
+		return nil, a.lineErr(line, io.ErrUnexpectedEOF)
+	}
+	fields := strings.Fields(line)
+	if len(fields) < min || len(fields) > max {
+		return nil, a.lineErr(line, ErrAIGERLiteral)
+	}
+	lits := make([]int, len(fields))
+	for i, f := range fields {
+		lit, err := strconv.Atoi(f)
+		if err != nil || lit < 0 || lit/2 > a.m {
+			return nil, a.lineErr(line, ErrAIGERLiteral)
+		}
+		lits[i] = lit
+	}
+	return lits, nil
+}
+
+func (a *aigerReader) read() error {
+	header, err := a.readLine()
+	if err != nil {
+		return a.lineErr(header, ErrAIGERHeader)
+	}
+	fields := strings.Fields(header)
+	if len(fields) < 6 || len(fields) > 10 || (fields[0] != "aag" && fields[0] != "aig") {
+		return a.lineErr(header, ErrAIGERHeader)
+	}
+	a.binary = fields[0] == "aig"
+
+	counts := make([]int, 9)
+	for i, f := range fields[1:] {
+		if counts[i], err = strconv.Atoi(f); err != nil || counts[i] < 0 {
+			return a.lineErr(header, ErrAIGERHeader)
+		}
+	}
+	a.m, a.i, a.l, a.o, a.a, a.b = counts[0], counts[1], counts[2], counts[3], counts[4], counts[5]
+	if a.m < a.i+a.l+a.a {
+		return a.lineErr(header, ErrAIGERHeader)
+	}
+	// Invariant constraints, justice and fairness properties
+	if counts[6] != 0 || counts[7] != 0 || counts[8] != 0 {
+		return a.lineErr(header, fmt.Errorf("%w: constraints and liveness properties", ErrAIGERUnsupported))
+	}
+
+	for i := 0; i < a.i; i++ {
+		if a.binary {
+			a.inputs = append(a.inputs, 2*(i+1))
+			continue
+		}
+		lits, err := a.readLiterals(1, 1)
+		if err != nil {
+			return err
+		}
+		if err := a.checkDefinition(lits[0]); err != nil {
+			return err
+		}
+		a.inputs = append(a.inputs, lits[0])
+	}
+
+	init := make([]byte, a.l)
+	for i := 0; i < a.l; i++ {
+		var latch [2]int
+		var lits []int
+		if a.binary {
+			latch[0] = 2 * (a.i + i + 1)
+			lits, err = a.readLiterals(1, 2)
+			if err != nil {
+				return err
+			}
+			lits = append([]int{latch[0]}, lits...)
+		} else {
+			lits, err = a.readLiterals(2, 3)
+			if err != nil {
+				return err
+			}
+			if err := a.checkDefinition(lits[0]); err != nil {
+				return err
+			}
+			latch[0] = lits[0]
+		}
+		latch[1] = lits[1]
+
+		// Latches without a reset value start at zero, and a latch that
+		// resets to itself is uninitialized
+		init[i] = '0'
+		if len(lits) == 3 {
+			switch lits[2] {
+			case 0:
+			case 1:
+				init[i] = '1'
+			case latch[0]:
+				init[i] = 'X'
+			default:
+				return a.lineErr(strconv.Itoa(lits[2]), ErrAIGERLiteral)
+			}
+		}
+		a.latches = append(a.latches, latch)
+	}
+	a.init = string(init)
+
+	for i := 0; i < a.o+a.b; i++ {
+		lits, err := a.readLiterals(1, 1)
+		if err != nil {
+			return err
+		}
+		if i < a.o {
+			a.outputs = append(a.outputs, lits[0])
+		} else {
+			a.bad = append(a.bad, lits[0])
+		}
+	}
+
+	for i := 0; i < a.a; i++ {
+		if a.binary {
+			lhs := 2 * (a.i + a.l + i + 1)
+			delta0, err := a.readDelta()
+			if err != nil {
+				return err
+			}
+			delta1, err := a.readDelta()
+			if err != nil {
+				return err
+			}
+			rhs0 := lhs - delta0
+			rhs1 := rhs0 - delta1
+			if rhs0 < 0 || rhs1 < 0 {
+				return a.lineErr("binary AND section", ErrAIGERLiteral)
+			}
+			a.ands = append(a.ands, [3]int{lhs, rhs0, rhs1})
+			continue
+		}
+		lits, err := a.readLiterals(3, 3)
+		if err != nil {
+			return err
+		}
+		if err := a.checkDefinition(lits[0]); err != nil {
+			return err
+		}
+		a.ands = append(a.ands, [3]int{lits[0], lits[1], lits[2]})
+	}
+
+	return a.readSymbols()
+}
+
+// Inputs, latches and ANDs define a variable, so they must be given a
+// positive, non-constant literal
+func (a *aigerReader) checkDefinition(lit int) error {
+	if lit%2 != 0 || lit < 2 {
+		return a.lineErr(strconv.Itoa(lit), ErrAIGERLiteral)
+	}
+	return nil
+}
+
+// Reads one of the variable length integers the binary format uses to
+// encode AND gates, seven bits at a time
+func (a *aigerReader) readDelta() (int, error) {
+	x, shift := 0, uint(0)
+	for {
+		c, err := a.r.ReadByte()
+		if err != nil {
+			return 0, a.lineErr("binary AND section", io.ErrUnexpectedEOF)
+		}
+		x |= int(c&0x7f) << shift
+		if c&0x80 == 0 {
+			return x, nil
+		}
+		shift += 7
+	}
+}
+
+// The symbol table is optional, and ends at the comment section or EOF
+func (a *aigerReader) readSymbols() error {
+	a.symbols = make(map[string]string)
+	for {
+		line, err := a.readLine()
+		if line == "c" || (err != nil && line == "") {
+			return nil
+		}
+		sp := strings.SplitN(line, " ", 2)
+		if len(sp) != 2 || len(sp[0]) < 2 || !strings.ContainsAny(sp[0][:1], "ilob") {
+			return a.lineErr(line, ErrSyntax)
+		}
+		a.symbols[sp[0]] = badNetCharRE.ReplaceAllString(sp[1], "_")
+		if err != nil {
+			return nil
+		}
+	}
+}
+
+// Hands out a net name that hasn't been used yet, preferring the given one
+func (a *aigerReader) uniqueName(name string) string {
+	for a.used[name] {
+		name += "_"
+	}
+	a.used[name] = true
+	return name
+}
+
+// The name of the net with the value of the given literal, adding a NOT gate
+// to the lines if it's negated and we haven't seen that yet. Literals 0 and 1
+// are the constants, which get a gate the first time they're used.
+func (a *aigerReader) literalName(lit int, lines *[]fileLine) string {
+	v := lit / 2
+	if v == 0 {
+		slot := lit * (a.m + 1)
+		if a.names[slot] == "" {
+			a.names[slot] = a.uniqueName("const" + strconv.Itoa(lit))
+			*lines = append(*lines, fileLine{output: a.names[slot], gateType: "CONST" + strconv.Itoa(lit)})
+		}
+		return a.names[slot]
+	}
+	if lit%2 == 0 {
+		return a.names[v]
+	}
+	if a.names[v+a.m+1] == "" {
+		a.names[v+a.m+1] = a.uniqueName(a.names[v] + "_n")
+		*lines = append(*lines, fileLine{output: a.names[v+a.m+1], inputs: []string{a.names[v]}, gateType: "NOT"})
+	}
+	return a.names[v+a.m+1]
+}
+
+// Converts the AIG we've read into the lines of an equivalent bench file
+func (a *aigerReader) fileLines() []fileLine {
+	// The first half of names are the positive literals, the second half negative
+	a.names = make([]string, 2*(a.m+1))
+	a.used = make(map[string]bool)
+
+	symbol := func(kind string, i int, def string) string {
+		if s, ok := a.symbols[kind+strconv.Itoa(i)]; ok {
+			return a.uniqueName(s)
+		}
+		return a.uniqueName(def)
+	}
+
+	var lines []fileLine
+	for i, lit := range a.inputs {
+		a.names[lit/2] = symbol("i", i, "i"+strconv.Itoa(i))
+		lines = append(lines, fileLine{output: a.names[lit/2], gateType: "INPUT", isIO: true})
+	}
+	for i, latch := range a.latches {
+		a.names[latch[0]/2] = symbol("l", i, "l"+strconv.Itoa(i))
+	}
+	for _, and := range a.ands {
+		a.names[and[0]/2] = a.uniqueName("a" + strconv.Itoa(and[0]/2))
+	}
+
+	for _, latch := range a.latches {
+		lines = append(lines, fileLine{output: a.names[latch[0]/2], inputs: []string{a.literalName(latch[1], &lines)}, gateType: "DFF"})
+	}
+	for _, and := range a.ands {
+		ins := []string{a.literalName(and[1], &lines), a.literalName(and[2], &lines)}
+		lines = append(lines, fileLine{output: a.names[and[0]/2], inputs: ins, gateType: "AND"})
+	}
+
+	addOutput := func(name string, lit int) {
+		lines = append(lines, fileLine{output: name, inputs: []string{a.literalName(lit, &lines)}, gateType: "BUFF"})
+		lines = append(lines, fileLine{output: name, gateType: "OUTPUT", isIO: true})
+	}
+	for i, lit := range a.outputs {
+		addOutput(symbol("o", i, "o"+strconv.Itoa(i)), lit)
+	}
+	for i, lit := range a.bad {
+		addOutput(symbol("b", i, "b"+strconv.Itoa(i)), lit)
+	}
+
+	for i := range lines {
+		lines[i].text = lines[i].String()
+	}
+	return lines
+}
@@ -0,0 +1,101 @@
+package bench
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// A two bit counter with an enable, where the high bit resets to 1 and the
+// bad state is both bits being on
+const counterAAG = `aag 11 1 2 0 8 1
+2
+4 13
+6 21 1
+22
+8 4 3
+10 5 2
+12 9 11
+14 4 2
+16 6 15
+18 7 14
+20 17 19
+22 6 4
+i0 en
+l0 q0
+l1 q1
+b0 bad
+c
+A comment
+`
+
+// The same counter, with the ANDs in the binary delta encoding
+var counterAIG = "aig 11 1 2 0 8 1\n13\n21 1\n22\n" +
+	"\x04\x01\x05\x03\x01\x02\x0a\x02\x01\x09\x04\x07\x01\x02\x10\x02" +
+	"i0 en\nl0 q0\nl1 q1\nb0 bad\n"
+
+func TestAIGER(t *testing.T) {
+	ascii, err := NewAIGER(strings.NewReader(counterAAG), "11")
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary, err := NewAIGER(strings.NewReader(counterAIG), "11")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if init := ascii.initPatterns()[0]; init != "01" {
+		t.Errorf("Expected initial state 01, Got %s", init)
+	}
+	if _, ok := ascii.portMap["bad"]; !ok {
+		t.Error("Expected a net for the bad state property")
+	}
+
+	tests := []struct {
+		state, input, exp string
+	}{
+		{"00", "0", "00"},
+		{"00", "1", "10"},
+		{"10", "1", "01"},
+		{"11", "1", "00"},
+		{"11", "0", "11"},
+	}
+	for _, test := range tests {
+		for _, bench := range []*Bench{ascii, binary} {
+			if s := bench.NextState(test.state, test.input); s != test.exp {
+				t.Errorf("%s with inputs %s: Expected %s, Got %s", test.state, test.input, test.exp, s)
+			}
+		}
+	}
+
+	if ok, _ := ascii.IsReachable(); !ok {
+		t.Error("Expected 11 to be reachable")
+	}
+	checkGateClauses(t, ascii)
+
+	// A latch that resets to itself can start with either value
+	uninit, err := NewAIGER(strings.NewReader("aag 2 1 1 0 0\n2\n4 2 4\n"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if init := uninit.initPatterns()[0]; init != "X" {
+		t.Errorf("Expected initial state X, Got %s", init)
+	}
+}
+
+func TestAIGERErrors(t *testing.T) {
+	tests := []struct {
+		src string
+		err error
+	}{
+		{"aag 1 1 0 0\n2\n", ErrAIGERHeader},
+		{"aag 1 1 0 0 0 0 1\n2\n", ErrAIGERUnsupported},
+		{"aag 1 1 0 1 0\n2\n4\n", ErrAIGERLiteral},
+		{"aag 2 1 1 0 0\n2\n4 2 2\n", ErrAIGERLiteral},
+	}
+	for _, test := range tests {
+		if _, err := NewAIGER(strings.NewReader(test.src), ""); !errors.Is(err, test.err) {
+			t.Errorf("%q: Expected %v, Got %v", test.src, test.err, err)
+		}
+	}
+}
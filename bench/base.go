@@ -9,12 +9,31 @@ type Bench struct {
 	LogLevel    int
 	RunnerCount int
 
+	// The name of the netlist, used in error messages
+	name string
+
 	// The bench file in a more convenient format
 	lines []fileLine
 
+	// The initial states, with a 0, 1 or X for each flip flop. If there are
+	// none, every flip flop starts off
+	init []string
+
+	// For a circuit cut down to the cone of influence of its goals, the one
+	// it came from, for filling in traces
+	full *fullCircuit
+
+	// Whether traces name the flip flops and inputs
+	namedTraces bool
+
 	// Runners are used for finding valid state transitions
 	runners []*runner
 
+	// Each line of the goal, and a runner of its own for checking the ones
+	// that are properties
+	goals      []*goal
+	goalRunner *runner
+
 	/*
 	 All of the fields below this block comment are various representational
 	 aspects of the bench file, and are read by the runners, but don't need to be
@@ -52,8 +71,20 @@ type Bench struct {
 	// List of input gate IDs
 	inputs []int
 
+	// List of constant gate IDs
+	consts []int
+
+	// List of output port names
+	outputs []string
+
 	// List of ports by gateID
 	ports []ports
+
+	// The truth table of each LUT, indexed by gate ID
+	luts []uint64
+
+	// The combinational gates, compiled in the order they're evaluated
+	program []instr
 }
 
 // The information from a single line in a bench file
@@ -62,12 +93,27 @@ type fileLine struct {
 	inputs   []string
 	gateType string
 	isIO     bool
+
+	// For LUTs, the truth table as a hex mask, and for flip flops, the value
+	// they start with
+	param string
+
+	// For subcircuit instances, the subcircuit port and outside net of each
+	// connection
+	conns [][2]string
+
+	// Where the line came from, for error messages
+	num  int
+	text string
 }
 
 // Port IDs from a single gate, for SAT solving
 type ports struct {
 	inputs []int
 	output int
+
+	// Intermediate ports for gates that are encoded as a chain of smaller gates
+	aux []int
 }
 
 type State struct {
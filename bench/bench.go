@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"regexp"
@@ -17,16 +18,32 @@ import (
 // V0 = AND(A,X1)
 // V1 = NOT(X1)
 // V2 = DFF(V1) // V3 = DFF(V0)
+// V4 = OR(A, X1, V2, V3)
 // The regex will capture the output port name, the gate type,
-// and the input port name(s). The examples above would yield
-// the following captures:
-// V0, AND, A, X1
-// V1, NOT, X1
-// V2, DFF, V1
-// V3, DFF, V0
-// And this is all we need to build up our network
-var gateRE = regexp.MustCompile(`^(\w+)\s*=\s*(\w+)\((\w+)\s*(?:,\s*(\w+))?\)$`)
-var inOutRE = regexp.MustCompile(`^(\w+)\((\w+)\)$`)
+// and the comma separated list of input port names. The examples above
+// would yield the following captures:
+// V0, AND, "A,X1"
+// V1, NOT, "X1"
+// V2, DFF, "V1"
+// V3, DFF, "V0"
+// V4, OR, "A, X1, V2, V3"
+// A LUT also has its mask after the gate type, like X = LUT 0x8 (A, B), and
+// a flip flop can have its initial value there, like Q = DFF 1 (D).
+// The input list is then split up by toFileLine, and this is all we need to
+// build up our network. Besides word characters, net names can contain the
+// dots, brackets and dollar signs that synthesis tools like to use.
+const netName = `[\w.\[\]$]+`
+
+var gateRE = regexp.MustCompile(`^(` + netName + `)\s*=\s*(\w+(?:\s+(?:0[xX][0-9a-fA-F]+|[01xX]))?)\s*\(\s*((?:` + netName + `(?:\s*,\s*` + netName + `)*)?)\s*\)$`)
+var inOutRE = regexp.MustCompile(`^(\w+)\s*\(\s*(` + netName + `)\s*\)$`)
+
+// Subcircuit instances connect each of the subcircuit's ports to a net by
+// name, like u1 = counter(en = A, q = Q1)
+var instRE = regexp.MustCompile(`^(` + netName + `)\s*=\s*(\w+)\s*\(\s*(` + netName + `\s*=\s*` + netName + `(?:\s*,\s*` + netName + `\s*=\s*` + netName + `)*)\s*\)$`)
+
+// Matches the characters that can't appear in a net name, for cleaning up
+// names from other formats
+var badNetCharRE = regexp.MustCompile(`[^\w.\[\]$]`)
 
 const (
 	None = iota
@@ -34,47 +51,127 @@ const (
 	Verbose
 )
 
-func NewFromFile(filename string, nRunners int) (*Bench, error) {
-	bench := &Bench{RunnerCount: nRunners}
-	bench.runners = make([]*runner, bench.RunnerCount)
-
-	bench.portMap = make(map[string]int)
-	bench.gateInputs = make(map[string][]int)
-	bench.gateOutputs = make(map[string]int)
+// The netlist formats NewFromFile knows how to read, in the order it looks
+// for them
+var formats = []struct {
+	ext string
+	new func(io.Reader, string, ...Option) (*Bench, error)
+}{
+	{".bench", New},
+	{".aag", NewAIGER},
+	{".aig", NewAIGER},
+	{".blif", NewBLIF},
+	{".v", NewVerilog},
+}
 
+// NewFromFile reads the netlist from filename with any of the extensions in
+// formats, and the goal state from filename.state. If there's a
+// filename.init, it lists the initial states, one per line.
+func NewFromFile(filename string, nRunners int, opts ...Option) (*Bench, error) {
 	goalState, err := ioutil.ReadFile(filename + ".state")
 	if err != nil {
 		return nil, err
 	}
-	bench.Goal = strings.TrimSpace(string(goalState))
 
-	file, err := os.Open(filename + ".bench")
+	opts = append([]Option{WithRunners(nRunners)}, opts...)
+	initStates, err := ioutil.ReadFile(filename + ".init")
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if states := strings.Fields(string(initStates)); len(states) > 0 {
+		opts = append([]Option{WithInit(states...)}, opts...)
+	}
+
+	var file *os.File
+	var format int
+	for format = range formats {
+		file, err = os.Open(filename + formats[format].ext)
+		if !os.IsNotExist(err) {
+			break
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := scanner.Text()
-		line = strings.TrimSpace(line)
-		bench.lines = append(bench.lines, toFileLine(line))
-	}
+	opts = append([]Option{WithName(file.Name())}, opts...)
+	return formats[format].new(file, string(goalState), opts...)
+}
 
-	bench.loadLines(bench.lines)
-	bench.parseLines(bench.lines)
-	for i := 0; i < bench.RunnerCount; i++ {
-		bench.runners[i] = &runner{id: i, outState: make([]outState, len(bench.toOutputs)), b: bench}
+// New reads a bench netlist from r, looking for the given goal state. Any
+// subcircuits it defines are flattened into a single circuit.
+func New(r io.Reader, goal string, opts ...Option) (*Bench, error) {
+	bench := newBench(goal, opts)
+
+	scanner := bufio.NewScanner(r)
+	num := 0
+	for scanner.Scan() {
+		num++
+		line := cleanLine(scanner.Text())
+		if line == "" {
+			continue
+		}
+		fileLine := toFileLine(line)
+		fileLine.num, fileLine.text = num, line
+		bench.lines = append(bench.lines, fileLine)
 	}
 
 	if err := scanner.Err(); err != nil {
 		return nil, err
 	}
 
+	lines, err := flatten(bench.name, bench.lines)
+	if err != nil {
+		return nil, err
+	}
+	bench.lines = lines
+	if err := bench.load(); err != nil {
+		return nil, err
+	}
 	return bench, nil
 }
 
+func newBench(goal string, opts []Option) *Bench {
+	bench := &Bench{Goal: strings.TrimSpace(goal), RunnerCount: 1, name: "netlist"}
+	for _, opt := range opts {
+		opt(bench)
+	}
+
+	bench.portMap = make(map[string]int)
+	bench.gateInputs = make(map[string][]int)
+	bench.gateOutputs = make(map[string]int)
+	return bench
+}
+
+// Checks the lines we've read in, and builds up the network from them
+func (b *Bench) load() error {
+	if err := checkLines(b.name, b.lines); err != nil {
+		return err
+	}
+
+	b.loadLines(b.lines)
+	b.parseLines(b.lines)
+	b.program = b.compile()
+	if init := annotatedInit(b.lines); init != "" {
+		b.defaultInit(init)
+	}
+	if err := b.checkGoal(); err != nil {
+		return err
+	}
+	if err := b.checkInit(); err != nil {
+		return err
+	}
+
+	b.runners = make([]*runner, b.RunnerCount)
+	for i := 0; i < b.RunnerCount; i++ {
+		b.runners[i] = &runner{id: i, outState: make([]outState, len(b.toOutputs)), b: b}
+	}
+	b.goalRunner = &runner{id: b.RunnerCount, outState: make([]outState, len(b.toOutputs)), b: b}
+	return nil
+}
+
 func (b *Bench) loadLines(f []fileLine) {
 	var id int
 	for _, line := range f {
@@ -93,14 +190,12 @@ func (b *Bench) loadLines(f []fileLine) {
 			b.inputCount++
 			b.gateOutputs[line.output] = id
 		case "OUTPUT":
-			// Currently we don't do anything with outputs
-		case "AND":
+			b.outputs = append(b.outputs, line.output)
+		case "AND", "OR", "NAND", "NOR", "XOR", "XNOR", "NOT", "BUFF", "DFF", "DFFE", "DFFR", "DFFS", "MUX", "LUT", "CONST0", "CONST1", "GND", "VDD":
 			b.gateOutputs[line.output] = id
-			b.gateInputs[line.inputs[0]] = append(b.gateInputs[line.inputs[0]], id)
-			b.gateInputs[line.inputs[1]] = append(b.gateInputs[line.inputs[1]], id)
-		case "NOT", "DFF":
-			b.gateOutputs[line.output] = id
-			b.gateInputs[line.inputs[0]] = append(b.gateInputs[line.inputs[0]], id)
+			for _, in := range line.inputs {
+				b.gateInputs[in] = append(b.gateInputs[in], id)
+			}
 		}
 	}
 
@@ -110,6 +205,7 @@ func (b *Bench) loadLines(f []fileLine) {
 	b.toInputs = make([][]int, totalCount)
 	b.toOutputs = make([][]int, totalCount)
 	b.ports = make([]ports, totalCount)
+	b.luts = make([]uint64, totalCount)
 
 	b.lastGateID = 0
 }
@@ -118,11 +214,39 @@ func (b *Bench) parseLines(f []fileLine) {
 	for _, line := range f {
 		switch line.gateType {
 		case "AND":
-			b.addAND(line.inputs[0], line.inputs[1], line.output)
+			b.addAND(line.inputs, line.output)
+		case "OR":
+			b.addOR(line.inputs, line.output)
+		case "NAND":
+			b.addNAND(line.inputs, line.output)
+		case "NOR":
+			b.addNOR(line.inputs, line.output)
+		case "XOR":
+			b.addXOR(line.inputs, line.output)
+		case "XNOR":
+			b.addXNOR(line.inputs, line.output)
 		case "NOT":
 			b.addNOT(line.inputs[0], line.output)
+		case "BUFF":
+			b.addBUFF(line.inputs[0], line.output)
 		case "DFF":
-			b.addDFF(line.inputs[0], line.output)
+			b.addDFF(line.inputs, line.output)
+		case "DFFE":
+			b.addDFFE(line.inputs, line.output)
+		case "DFFR":
+			b.addDFFR(line.inputs, line.output)
+		case "DFFS":
+			b.addDFFS(line.inputs, line.output)
+		case "MUX":
+			b.addMUX(line.inputs, line.output)
+		case "LUT":
+			// checkLines has already made sure the mask is good
+			mask, _ := parseMask(line.param)
+			b.addLUT(mask, line.inputs, line.output)
+		case "CONST0", "GND":
+			b.addConst(false, line.output)
+		case "CONST1", "VDD":
+			b.addConst(true, line.output)
 		case "INPUT":
 			b.addInput(line.output)
 		case "OUTPUT":
@@ -131,38 +255,109 @@ func (b *Bench) parseLines(f []fileLine) {
 	}
 }
 
-func (b *Bench) addAND(in1, in2, out string) {
-	id := b.nextGateID()
+func (b *Bench) addAND(ins []string, out string) {
+	id := b.addGate(ins, out)
 	b.gateType[id].and = true
+}
 
-	// The gate whose output is attached to in1 gets this id added to its
-	// outputs, and we add that gate to our list of inputs
-	g := b.gateOutputs[in1]
-	//b.toOutputs[g].to = append(b.toOutputs[g].to, id)
-	b.toInputs[id] = append(b.toInputs[id], g)
+func (b *Bench) addOR(ins []string, out string) {
+	id := b.addGate(ins, out)
+	b.gateType[id].or = true
+}
 
-	g = b.gateOutputs[in2]
-	//b.toOutputs[g].to = append(b.toOutputs[g].to, id)
-	b.toInputs[id] = append(b.toInputs[id], g)
+func (b *Bench) addNAND(ins []string, out string) {
+	id := b.addGate(ins, out)
+	b.gateType[id].nand = true
+}
 
-	// We find a list of all the gates that use our output as an input
-	gs := b.gateInputs[out]
-	for _, g := range gs {
-		//b.toInputs[g] = append(b.toInputs[g], id)
-		b.toOutputs[id] = append(b.toOutputs[id], g)
+func (b *Bench) addNOR(ins []string, out string) {
+	id := b.addGate(ins, out)
+	b.gateType[id].nor = true
+}
+
+func (b *Bench) addXOR(ins []string, out string) {
+	id := b.addGate(ins, out)
+	b.gateType[id].xor = true
+	b.addParityPorts(id)
+}
+
+func (b *Bench) addXNOR(ins []string, out string) {
+	id := b.addGate(ins, out)
+	b.gateType[id].xnor = true
+	b.addParityPorts(id)
+}
+
+// A parity gate with n inputs is encoded in the CNF as a chain of n-1
+// two-input XORs, so it needs n-2 ports to hold the intermediate results
+func (b *Bench) addParityPorts(id int) {
+	for i := 2; i < len(b.ports[id].inputs); i++ {
+		b.ports[id].aux = append(b.ports[id].aux, b.newAuxPort())
 	}
-	b.ports[id] = ports{inputs: []int{b.portID(in1), b.portID(in2)}, output: b.portID(out)}
 }
 
 func (b *Bench) addNOT(in, out string) {
-	id := b.addOneInputGate(in, out)
+	id := b.addGate([]string{in}, out)
 	b.gateType[id].not = true
 }
 
-func (b *Bench) addDFF(in, out string) {
-	id := b.addOneInputGate(in, out)
+func (b *Bench) addBUFF(in, out string) {
+	id := b.addGate([]string{in}, out)
+	b.gateType[id].buff = true
+}
+
+func (b *Bench) addDFF(ins []string, out string) int {
+	id := b.addGate(ins, out)
 	b.ffs = append(b.ffs, id)
 	b.gateType[id].ff = true
+	return id
+}
+
+// A DFFE only loads its D input, the first one, when its enable, the second
+// one, is on
+func (b *Bench) addDFFE(ins []string, out string) {
+	id := b.addDFF(ins, out)
+	b.gateType[id].enable = true
+	b.addNextPort(id)
+}
+
+// DFFRs and DFFSs synchronously reset or set when their second input is on
+func (b *Bench) addDFFR(ins []string, out string) {
+	id := b.addDFF(ins, out)
+	b.gateType[id].reset = true
+	b.addNextPort(id)
+}
+
+func (b *Bench) addDFFS(ins []string, out string) {
+	id := b.addDFF(ins, out)
+	b.gateType[id].set = true
+	b.addNextPort(id)
+}
+
+// The value a flip flop with an enable, reset or set takes next isn't any
+// one of its inputs, so the CNF needs a port to hold it
+func (b *Bench) addNextPort(id int) {
+	b.ports[id].aux = []int{b.newAuxPort()}
+}
+
+// A MUX's inputs are the select line, then the inputs it picks when the
+// select line is off and on
+func (b *Bench) addMUX(ins []string, out string) {
+	id := b.addGate(ins, out)
+	b.gateType[id].mux = true
+}
+
+func (b *Bench) addLUT(mask uint64, ins []string, out string) {
+	id := b.addGate(ins, out)
+	b.gateType[id].lut = true
+	b.luts[id] = mask
+}
+
+// Constants are gates without any inputs, tied to a value
+func (b *Bench) addConst(on bool, out string) {
+	id := b.addGate(nil, out)
+	b.consts = append(b.consts, id)
+	b.gateType[id].const0 = !on
+	b.gateType[id].const1 = on
 }
 
 func (b *Bench) addInput(out string) {
@@ -177,24 +372,29 @@ func (b *Bench) addInput(out string) {
 	}
 
 	b.inputs = append(b.inputs, id)
+	// Every input gets a port, even if nothing reads it, so it can be named
+	// in a property and read back from a solution
+	b.ports[id] = ports{output: b.portID(out)}
 }
 
-func (b *Bench) addOneInputGate(in, out string) int {
+func (b *Bench) addGate(ins []string, out string) int {
 	id := b.nextGateID()
 
-	// The gate whose output is attached to in1 gets this id added to its
-	// outputs, and we add that gate to our list of inputs
-	g := b.gateOutputs[in]
-	//b.toOutputs[g].to = append(b.toOutputs[g].to, id)
-	b.toInputs[id] = append(b.toInputs[id], g)
+	// The gates whose outputs are attached to our inputs get this id added to
+	// their outputs, and we add those gates to our list of inputs
+	inPorts := make([]int, len(ins))
+	for i, in := range ins {
+		g := b.gateOutputs[in]
+		b.toInputs[id] = append(b.toInputs[id], g)
+		inPorts[i] = b.portID(in)
+	}
 
 	// We find a list of all the gates that use our output as an input
 	gs := b.gateInputs[out]
 	for _, g := range gs {
-		//b.toInputs[g] = append(b.toInputs[g], id)
 		b.toOutputs[id] = append(b.toOutputs[id], g)
 	}
-	b.ports[id] = ports{inputs: []int{b.portID(in)}, output: b.portID(out)}
+	b.ports[id] = ports{inputs: inPorts, output: b.portID(out)}
 	return id
 }
 
@@ -210,6 +410,17 @@ func (b *Bench) nextPortID() int {
 	return b.lastPortID
 }
 
+// Ports that only exist in the CNF don't get a name, so they can't be mixed
+// up with a net
+func (b *Bench) newAuxPort() int {
+	return b.nextPortID()
+}
+
+// The number of ports, including the ones without a name
+func (b *Bench) portCount() int {
+	return b.lastPortID
+}
+
 func (b *Bench) portID(name string) int {
 	if id, ok := b.portMap[name]; ok {
 		return id
@@ -220,19 +431,33 @@ func (b *Bench) portID(name string) int {
 	}
 }
 
+// Formats the line the way it would appear in a bench file
+func (l fileLine) String() string {
+	if l.isIO {
+		return l.gateType + "(" + l.output + ")"
+	}
+	if l.param != "" {
+		return l.output + " = " + l.gateType + " " + l.param + " (" + strings.Join(l.inputs, ", ") + ")"
+	}
+	return l.output + " = " + l.gateType + "(" + strings.Join(l.inputs, ", ") + ")"
+}
+
 func toFileLine(line string) fileLine {
 	fileLine := fileLine{}
 	matches := gateRE.FindStringSubmatch(line)
 	// If we have matches, it's a gate statement
 	if gateRE.MatchString(line) {
-		out, gate := matches[1], matches[2]
-		fileLine.gateType = gate
+		out, gate := matches[1], strings.Fields(matches[2])
+		fileLine.gateType = gate[0]
+		if len(gate) > 1 {
+			fileLine.param = gate[1]
+		}
 		fileLine.output = out
-		switch gate {
-		case "AND":
-			fileLine.inputs = matches[3:5]
-		case "NOT", "DFF":
-			fileLine.inputs = matches[3:4]
+		// Constants don't have any inputs
+		if matches[3] != "" {
+			for _, in := range strings.Split(matches[3], ",") {
+				fileLine.inputs = append(fileLine.inputs, strings.TrimSpace(in))
+			}
 		}
 	} else if inOutRE.MatchString(line) {
 		ioMatch := inOutRE.FindStringSubmatch(line)
@@ -241,6 +466,16 @@ func toFileLine(line string) fileLine {
 		fileLine.isIO = true
 		fileLine.gateType = io
 		fileLine.output = port
+	} else if instRE.MatchString(line) {
+		instMatch := instRE.FindStringSubmatch(line)
+		fileLine.output, fileLine.gateType = instMatch[1], instMatch[2]
+		for _, conn := range strings.Split(instMatch[3], ",") {
+			sp := strings.SplitN(conn, "=", 2)
+			fileLine.conns = append(fileLine.conns, [2]string{strings.TrimSpace(sp[0]), strings.TrimSpace(sp[1])})
+		}
+	} else if line == "ENDS" {
+		fileLine.isIO = true
+		fileLine.gateType = line
 	}
 
 	return fileLine
@@ -253,37 +488,64 @@ func (b *Bench) ReachableStates() map[string][]State {
 }
 
 func (b *Bench) IsReachable() (bool, map[string][]State) {
-	states := b.reachableStates(func(s string) bool {
-		return s == b.Goal
-	})
+	states := b.reachableStates(b.IsGoal)
 
 	for state := range states {
-		if state == b.Goal {
+		if b.IsGoal(state) {
 			return true, states
 		}
 	}
 	return false, states
 }
 
+// IsGoal reports whether the state matches the goal, where X or - in the goal
+// matches either value. When the goal is a property, it reports whether there
+// are inputs that make the property true in the state. With more than one
+// goal, only the first one counts.
+func (b *Bench) IsGoal(state string) bool {
+	if len(b.goals) == 0 {
+		return false
+	}
+	return b.matches(b.goals[0], state)
+}
+
+func isDontCare(bit byte) bool {
+	return bit == 'X' || bit == 'x' || bit == '-'
+}
+
 // To find all of the reachable states, we spin up a bunch of worker threads.
 // Every time a worker thread finds a new state, it passes it back over the
 // channel, and we place it onto the queue for another worker to use
 func (b *Bench) reachableStates(goalFunc func(string) bool) map[string][]State {
-	initState := strings.Repeat("0", len(b.ffs))
+	initStates := b.initialStates()
 	nextStates := make(map[string][]State)
-	nextStates[initState] = []State{}
+	for _, initState := range initStates {
+		nextStates[initState] = []State{}
+	}
 
 	statesToCheck := make(chan string, 1000)
 	foundStates := make(chan newState, 1000)
 	searched := make(chan bool, b.RunnerCount)
-	statesToCheck <- initState
 
 	// Spin up our runners
 	for _, r := range b.runners {
 		go r.reachableFromState(statesToCheck, foundStates, searched)
 	}
 
-	totalStates := 1
+	// There can be more initial states than fit in the channel, so they're
+	// sent from another goroutine while we start collecting results
+	go func() {
+		for _, initState := range initStates {
+			statesToCheck <- initState
+		}
+	}()
+
+	totalStates := len(initStates)
+	for _, initState := range initStates {
+		if goalFunc(initState) {
+			return nextStates
+		}
+	}
 Loop:
 	for {
 		select {
@@ -316,6 +578,73 @@ Loop:
 	return nextStates
 }
 
+// Sets the initial state given by the netlist, unless one was already given
+// as an option
+func (b *Bench) defaultInit(state string) {
+	if b.init == nil {
+		b.init = []string{state}
+	}
+}
+
+// The initial state the flip flops are annotated with, where the ones that
+// aren't start off, or nothing if none of them are annotated
+func annotatedInit(f []fileLine) string {
+	var init []byte
+	annotated := false
+	for _, line := range f {
+		if !flipFlops[line.gateType] {
+			continue
+		}
+		bit := byte('0')
+		if line.param != "" {
+			bit, annotated = strings.ToUpper(line.param)[0], true
+		}
+		init = append(init, bit)
+	}
+	if !annotated {
+		return ""
+	}
+	return string(init)
+}
+
+// The initial state patterns, with Xs for flip flops that can start with
+// either value. Unless told otherwise, every flip flop starts off.
+func (b *Bench) initPatterns() []string {
+	if len(b.init) == 0 {
+		return []string{strings.Repeat("0", len(b.ffs))}
+	}
+	return b.init
+}
+
+// Every state the search starts from, with the Xs in the initial state
+// patterns expanded out to both values
+func (b *Bench) initialStates() []string {
+	seen := make(map[string]bool)
+	var states []string
+	for _, pattern := range b.initPatterns() {
+		expanded := []string{""}
+		for i := range pattern {
+			var next []string
+			for _, prefix := range expanded {
+				if pattern[i] != '1' {
+					next = append(next, prefix+"0")
+				}
+				if pattern[i] != '0' {
+					next = append(next, prefix+"1")
+				}
+			}
+			expanded = next
+		}
+		for _, state := range expanded {
+			if !seen[state] {
+				seen[state] = true
+				states = append(states, state)
+			}
+		}
+	}
+	return states
+}
+
 func (b *Bench) debugStatement(statement string, level int) {
 	if level <= b.LogLevel {
 		fmt.Println(statement)
@@ -323,44 +652,121 @@ func (b *Bench) debugStatement(statement string, level int) {
 }
 
 func (b *Bench) Solution(nextStates map[string][]State) string {
+	prevStates := previousStates(nextStates)
+
+	// With don't cares in the goal more than one state can match it, so we
+	// pick the one with the shortest path
+	isInit := b.initialSet()
+	var final string
+	shortest := -1
+	for state := range nextStates {
+		if !b.IsGoal(state) {
+			continue
+		}
+		n := len(pathTo(prevStates, isInit, state))
+		if shortest < 0 || n < shortest || (n == shortest && state < final) {
+			final, shortest = state, n
+		}
+	}
+
+	return b.trace(prevStates, final, b.firstGoal())
+}
+
+// The goal that IsGoal, Solution and Sat look for, if there is one
+func (b *Bench) firstGoal() *goal {
+	if len(b.goals) == 0 {
+		return nil
+	}
+	return b.goals[0]
+}
+
+// Inverts the map of states we can reach from each state, to find the states
+// that can reach each state
+func previousStates(nextStates map[string][]State) map[string][]State {
 	prevStates := make(map[string][]State)
 	for state, states := range nextStates {
 		for _, prevState := range states {
 			prevStates[prevState.state] = append(prevStates[prevState.state], State{state: state, input: prevState.input})
 		}
 	}
-	currState := b.Goal
-	initState := strings.Repeat("0", len(b.ffs))
-	strs := []string{fmt.Sprint("Final: ", b.Goal, "\n")}
-	i := 0
-Loop:
-	for {
-		for _, prevState := range prevStates[currState] {
-			if prevState.state == initState {
-				strs = append(strs, fmt.Sprint("Initial: ", initState, " Inputs: ", prevState.input, "\n"))
-				break Loop
-			}
-		}
+	return prevStates
+}
+
+// The set of initial states, for knowing when to stop walking back
+func (b *Bench) initialSet() map[string]bool {
+	isInit := make(map[string]bool)
+	for _, initState := range b.initialStates() {
+		isInit[initState] = true
+	}
+	return isInit
+}
+
+// Walks back from a state to an initial one, collecting the steps
+func pathTo(prevStates map[string][]State, isInit map[string]bool, currState string) []State {
+	var steps []State
+	for !isInit[currState] {
 		prev := prevStates[currState][0]
-		strs = append(strs, fmt.Sprint(": ", prev.state, " Inputs: ", prev.input, "\n"))
+		steps = append(steps, prev)
 		currState = prev.state
-		i++
+	}
+	return steps
+}
+
+// Formats the steps from an initial state to the final one, which meets the
+// given goal
+func (b *Bench) trace(prevStates map[string][]State, final string, g *goal) string {
+	path := pathTo(prevStates, b.initialSet(), final)
+	steps := make([]State, len(path))
+	for i, step := range path {
+		steps[len(path)-1-i] = step
+	}
+
+	// For properties, we also need the inputs that make it true
+	last := State{state: final}
+	withInputs := g != nil && g.prop != nil
+	if withInputs {
+		last.input, _ = b.goalRunner.satisfyingInputs(final, g.prop)
+	}
+	return b.formatTrace(steps, last, withInputs)
+}
+
+// Formats a trace, given each step in order with the inputs applied in it,
+// and the state it ends in. Only properties need the final inputs.
+func (b *Bench) formatTrace(steps []State, final State, withInputs bool) string {
+	if b.full != nil {
+		steps, final = b.full.expand(steps, final)
+		return b.full.b.formatTrace(steps, final, withInputs)
+	}
+	return b.formatSteps(steps, final, withInputs)
+}
+
+// Formats the steps of a trace on this circuit, without filling in anything
+// that was cut away from it
+func (b *Bench) formatSteps(steps []State, final State, withInputs bool) string {
+	states, inputs := identity, identity
+	if b.namedTraces {
+		states, inputs = b.namer(b.ffs), b.namer(b.inputs)
 	}
 
 	var buf bytes.Buffer
-	for i := len(strs) - 1; i >= 0; i-- {
-		if i != 0 && i != len(strs)-1 {
-			buf.WriteString("State " + strconv.Itoa(len(strs)-i) + strs[i])
+	for i, step := range steps {
+		if i == 0 {
+			buf.WriteString("Initial: ")
 		} else {
-			buf.WriteString(strs[i])
+			buf.WriteString("State " + strconv.Itoa(i+1) + ": ")
 		}
+		buf.WriteString(fmt.Sprint(states(step.state), " Inputs: ", inputs(step.input), "\n"))
+	}
+	buf.WriteString(fmt.Sprint("Final: ", states(final.state)))
+	if withInputs {
+		buf.WriteString(fmt.Sprint(" Inputs: ", inputs(final.input)))
 	}
+	buf.WriteString("\n")
 	return buf.String()
 }
 
 func (b *Bench) NextState(state, input string) string {
 	r := b.runners[0]
-	r.clearState()
 	r.setInputs(input)
 	r.setState(state)
 	// Run the circuit
@@ -368,3 +774,46 @@ func (b *Bench) NextState(state, input string) string {
 	// nextState is the state we've reached by running our sim
 	return r.State()
 }
+
+// The combinational gates, ordered so that every gate comes after all of the
+// gates that drive it. Inputs and flip flops are left out, since their values
+// are known at the start of a step.
+func (b *Bench) topoOrder() []int {
+	order := make([]int, 0, len(b.toInputs))
+	visited := make([]bool, len(b.toInputs))
+
+	// A depth first search, where each frame remembers which input it's on
+	type frame struct{ id, in int }
+	var stack []frame
+	for id := range b.toInputs {
+		if visited[id] || b.gateType[id].input || b.gateType[id].ff {
+			continue
+		}
+		visited[id] = true
+		stack = append(stack, frame{id, 0})
+		for len(stack) > 0 {
+			top := &stack[len(stack)-1]
+			if top.in == len(b.toInputs[top.id]) {
+				order = append(order, top.id)
+				stack = stack[:len(stack)-1]
+				continue
+			}
+			in := b.toInputs[top.id][top.in]
+			top.in++
+			if !visited[in] && !b.gateType[in].input && !b.gateType[in].ff {
+				visited[in] = true
+				stack = append(stack, frame{in, 0})
+			}
+		}
+	}
+	return order
+}
+
+// The name of the net driven by each gate, indexed by gate ID
+func (b *Bench) gateNames() []string {
+	names := make([]string, len(b.toInputs))
+	for name, id := range b.gateOutputs {
+		names[id] = name
+	}
+	return names
+}
@@ -1,7 +1,13 @@
 package bench
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
 	"runtime"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -69,6 +75,31 @@ func BenchmarkIsReachableEx4(b *testing.B) {
 	runtime.GOMAXPROCS(prev)
 }
 
+func BenchmarkReachableStatesWide(b *testing.B) {
+	bench, err := New(strings.NewReader(wideCircuit(16, 6)), "111111", WithRunners(1))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		bench.ReachableStates()
+	}
+}
+
+// A shift register of flip flops, each of which mixes in a couple of inputs
+func wideCircuit(nInputs, nFFs int) string {
+	var buf bytes.Buffer
+	for i := 0; i < nInputs; i++ {
+		fmt.Fprintf(&buf, "INPUT(I%d)\n", i)
+	}
+	for i := 0; i < nFFs; i++ {
+		fmt.Fprintf(&buf, "Q%d = DFF(D%d)\n", i, i)
+		fmt.Fprintf(&buf, "A%d = AND(I%d, I%d)\n", i, i%nInputs, (i+nFFs)%nInputs)
+		fmt.Fprintf(&buf, "D%d = XOR(Q%d, A%d, I%d)\n", i, (i+nFFs-1)%nFFs, i, nInputs-1-i%nInputs)
+	}
+	return buf.String()
+}
+
 func BenchmarkRunLarge(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		nextState(b, "ex3", "00000000000000000000000000000", "1111111111000111")
@@ -251,3 +282,1001 @@ func isReachable(b *testing.B, in string, runners int) {
 	b.StartTimer()
 	bench.IsReachable()
 }
+
+func TestGateLibrary(t *testing.T) {
+	// Each flip flop latches the output of one gate type, so the next state
+	// spells out the truth table row for the current inputs
+	src := `INPUT(A)
+INPUT(B)
+Q0 = DFF(G0)
+Q1 = DFF(G1)
+Q2 = DFF(G2)
+Q3 = DFF(G3)
+Q4 = DFF(G4)
+Q5 = DFF(G5)
+Q6 = DFF(G6)
+Q7 = DFF(G7)
+G0 = AND(A, B)
+G1 = OR(A, B)
+G2 = NAND(A, B)
+G3 = NOR(A, B)
+G4 = XOR(A, B)
+G5 = XNOR(A, B)
+G6 = NOT(A)
+G7 = BUFF(B)
+`
+	bench := loadTestBench(t, src, "00000000")
+	tests := []struct {
+		input, exp string
+	}{
+		{"00", "00110110"},
+		{"01", "01101011"},
+		{"10", "01101000"},
+		{"11", "11000101"},
+	}
+	for _, test := range tests {
+		if s := bench.NextState("00000000", test.input); s != test.exp {
+			t.Errorf("Inputs %s: Expected %s, Got %s", test.input, test.exp, s)
+		}
+	}
+	checkGateClauses(t, bench)
+}
+
+// loadTestBench builds a Bench from the given netlist, failing the test if
+// it doesn't parse
+func loadTestBench(t *testing.T, src, goal string, opts ...Option) *Bench {
+	bench, err := New(strings.NewReader(src), goal, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bench
+}
+
+func TestWideGates(t *testing.T) {
+	src := `INPUT(A)
+INPUT(B)
+INPUT(C)
+Q0 = DFF(G0)
+Q1 = DFF(G1)
+Q2 = DFF(G2)
+Q3 = DFF(G3)
+Q4 = DFF(G4)
+Q5 = DFF(G5)
+G0 = AND(A, B, C)
+G1 = OR(A, B, C)
+G2 = NAND(A, B, C)
+G3 = NOR(A, B, C)
+G4 = XOR(A, B, C)
+G5 = XNOR( A , B , C )
+`
+	bench := loadTestBench(t, src, "000000")
+	tests := []struct {
+		input, exp string
+	}{
+		{"000", "001101"},
+		{"010", "011010"},
+		{"110", "011001"},
+		{"111", "110010"},
+	}
+	for _, test := range tests {
+		if s := bench.NextState("000000", test.input); s != test.exp {
+			t.Errorf("Inputs %s: Expected %s, Got %s", test.input, test.exp, s)
+		}
+	}
+	checkGateClauses(t, bench)
+
+	// A net named like the ports between the XORs in a chain gets its own
+	clash := loadTestBench(t, src+"Q6 = DFF(G4$1)\nG4$1 = AND(A, B)\n", "0000000")
+	checkGateClauses(t, clash)
+}
+
+// checkGateClauses makes sure that, for every combination of inputs, the CNF
+// for a single unrolling has exactly one solution and that it agrees with the
+// simulation. Only use it on small circuits, it enumerates every assignment.
+func checkGateClauses(t *testing.T, bench *Bench) {
+	clauses := bench.gateClauses(0)
+	fixed := make(map[int]int)
+	for name, id := range bench.gateOutputs {
+		if bench.gateType[id].input || bench.gateType[id].ff {
+			fixed[bench.portMap[name]] = id
+		}
+	}
+	var free []int
+	for port := 1; port <= bench.portCount(); port++ {
+		if _, ok := fixed[port]; !ok {
+			free = append(free, port)
+		}
+	}
+
+	r := bench.runners[0]
+	nIn, nFF := len(bench.inputs), len(bench.ffs)
+	for i := 0; i < 1<<uint(nIn+nFF); i++ {
+		input := fmt.Sprintf("%0*b", nIn+nFF, i)
+		r.setInputs(input[:nIn])
+		r.setState(input[nIn:])
+		r.run()
+
+		values := make([]bool, bench.portCount()+1)
+		for port, id := range fixed {
+			values[port] = r.outState[id].on
+		}
+		solutions := 0
+		for j := 0; j < 1<<uint(len(free)); j++ {
+			for k, port := range free {
+				values[port] = j&(1<<uint(k)) != 0
+			}
+			if !satisfies(clauses, values) {
+				continue
+			}
+			solutions++
+			for id := range bench.toOutputs {
+				if !bench.gateType[id].input && !bench.gateType[id].ff && values[bench.ports[id].output] != r.outState[id].on {
+					t.Errorf("Inputs %s: clauses disagree with simulation on gate %d", input, id)
+				}
+			}
+			for _, id := range bench.ffs {
+				if values[bench.nextPort(id)] != r.nextValue(id).on {
+					t.Errorf("Inputs %s: clauses disagree with simulation on the next value of flip flop %d", input, id)
+				}
+			}
+		}
+		if solutions != 1 {
+			t.Errorf("Inputs %s: Expected 1 solution, Got %d", input, solutions)
+		}
+	}
+}
+
+func satisfies(clauses []Clause, values []bool) bool {
+	for _, c := range clauses {
+		if !c.hasTerms() {
+			continue
+		}
+		sat := false
+		for _, term := range c.Terms {
+			if values[abs(term)] == (term > 0) {
+				sat = true
+				break
+			}
+		}
+		if !sat {
+			return false
+		}
+	}
+	return true
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		line int
+		err  error
+	}{
+		{"INPUT(A)\nG0 = AND(A, A\n", 2, ErrSyntax},
+		{"INPUT(A)\n# A comment\nG0 = MAJ(A, A)\n", 3, ErrUnknownGate},
+		{"INPUT(A)\nWIRE(A)\n", 2, ErrUnknownGate},
+		{"INPUT(A)\nG0 = NOT(A, A)\n", 2, ErrGateArity},
+		{"INPUT(A)\nG0 = NOT(A)\nG0 = BUFF(A)\n", 3, ErrMultipleDrivers},
+		{"INPUT(A)\nG0 = AND(A, B)\n", 2, ErrUndeclaredInput},
+		{"INPUT(A)\nOUTPUT(G0)\n", 2, ErrUndriven},
+		{"INPUT(A)\nG0 = AND(A, G2)\nG1 = NOT(G0)\nG2 = BUFF(G1)\n", 2, ErrCombinationalLoop},
+	}
+	for _, test := range tests {
+		_, err := New(strings.NewReader(test.src), "0", WithName("test.bench"))
+		var perr *ParseError
+		if !errors.As(err, &perr) {
+			t.Errorf("%q: Expected a *ParseError, Got %v", test.src, err)
+			continue
+		}
+		if !errors.Is(err, test.err) || perr.Line != test.line || perr.File != "test.bench" {
+			t.Errorf("%q: Expected %v on line %d, Got %v", test.src, test.err, test.line, err)
+		}
+	}
+
+	// Loops through a flip flop are fine
+	loadTestBench(t, "INPUT(A)\nG0 = AND(A, G2)\nG1 = NOT(G0)\nG2 = DFF(G1)\n", "0")
+}
+
+func TestDontCareGoal(t *testing.T) {
+	src := "INPUT(A)\nQ0 = DFF(A)\nQ1 = DFF(Q0)\nQ2 = DFF(Q1)\n"
+	bench := loadTestBench(t, src, "x-1")
+
+	ok, states := bench.IsReachable()
+	if !ok {
+		t.Fatal("Expected the goal to be reachable")
+	}
+	sol := bench.Solution(states)
+	lines := strings.Split(strings.TrimSpace(sol), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[0], "Initial: 000") || !regexpMatch(t, `^Final: ..1$`, lines[3]) {
+		t.Errorf("Expected a three step trace, Got:\n%s", sol)
+	}
+
+	if clauses := bench.endClauses(0); len(clauses) != 2 {
+		t.Errorf("Expected a comment and a single goal clause, Got %v", clauses)
+	}
+
+	for _, goal := range []string{"00", "0000", "00Z"} {
+		if _, err := New(strings.NewReader(src), goal); !errors.Is(err, ErrGoal) {
+			t.Errorf("%s: Expected %v, Got %v", goal, ErrGoal, err)
+		}
+	}
+}
+
+func TestInitialStates(t *testing.T) {
+	src := "INPUT(A)\nQ0 = DFF(A)\nQ1 = DFF(Q0)\nQ2 = DFF(Q1)\n"
+	init := []string{"1X0", "0-0"}
+	bench := loadTestBench(t, src, "0-1", WithInit(init...), WithUnroll(1))
+	if init[1] != "0-0" {
+		t.Errorf("Expected the caller's initial states to be left alone, Got %v", init)
+	}
+
+	starts := bench.initialStates()
+	want := []string{"100", "110", "000", "010"}
+	if strings.Join(starts, " ") != strings.Join(want, " ") {
+		t.Errorf("Expected initial states %v, Got %v", want, starts)
+	}
+
+	// 010 and 110 both reach the goal in one step
+	ok, states := bench.IsReachable()
+	if !ok {
+		t.Fatal("Expected the goal to be reachable")
+	}
+	sol := bench.Solution(states)
+	lines := strings.Split(strings.TrimSpace(sol), "\n")
+	if len(lines) != 2 || !regexpMatch(t, `^Initial: [01]10 `, lines[0]) || lines[1] != "Final: 0"+lines[0][10:11]+"1" {
+		t.Errorf("Expected a one step trace from an initial state, Got:\n%s", sol)
+	}
+
+	// The clauses should allow exactly the initial states, for some choice
+	// of selectors
+	clauses := bench.initClauses()
+	isInit := make(map[string]bool)
+	for _, s := range starts {
+		isInit[s] = true
+	}
+	nVars := bench.portCount()*bench.Unroll + 2
+	for i := 0; i < 8; i++ {
+		state := fmt.Sprintf("%03b", i)
+		found := false
+		for sel := 0; sel < 4; sel++ {
+			values := make([]bool, nVars+1)
+			for j, id := range bench.ffs {
+				values[bench.ports[id].output] = state[j] == '1'
+			}
+			values[nVars-1] = sel&1 != 0
+			values[nVars] = sel&2 != 0
+			found = found || satisfies(clauses, values)
+		}
+		if found != isInit[state] {
+			t.Errorf("%s: Expected the clauses to allow it to be %t, Got %t", state, isInit[state], found)
+		}
+	}
+
+	for _, init := range []string{"01", "0Z0"} {
+		if _, err := New(strings.NewReader(src), "", WithInit(init)); !errors.Is(err, ErrInit) {
+			t.Errorf("%s: Expected %v, Got %v", init, ErrInit, err)
+		}
+	}
+}
+
+func TestNetGoal(t *testing.T) {
+	src := "INPUT(A)\nOUTPUT(err)\nQ0 = DFF(A)\nQ1 = DFF(Q0)\nerr = AND(Q1, B)\nB = NOT(A)\n"
+	bench := loadTestBench(t, src, "err")
+
+	if bench.IsGoal("10") || !bench.IsGoal("01") {
+		t.Error("Expected err to be reachable only when Q1 is on")
+	}
+	ok, states := bench.IsReachable()
+	if !ok {
+		t.Fatal("Expected err to be reachable")
+	}
+	sol := bench.Solution(states)
+	lines := strings.Split(strings.TrimSpace(sol), "\n")
+	if len(lines) != 3 || !regexpMatch(t, `^Final: .1 Inputs: 0$`, lines[2]) {
+		t.Errorf("Expected a two step trace ending with A off, Got:\n%s", sol)
+	}
+
+	// Internal nets and inputs work too
+	bench = loadTestBench(t, src, "Q0 & !B & !err")
+	if !bench.IsGoal("10") || bench.IsGoal("01") {
+		t.Error("Expected the goal to hold with Q0 on and err off")
+	}
+	checkPropertyClauses(t, bench, bench.goals[0].prop)
+
+	tests := []struct {
+		goal string
+		err  error
+	}{
+		{"nope", ErrPropertyType},
+		{"err &", ErrPropertySyntax},
+		// Property errors are goal errors too
+		{"Q0 == 2'b10", ErrGoal},
+		{"0-1", ErrGoal},
+	}
+	for _, test := range tests {
+		if _, err := New(strings.NewReader(src), test.goal); !errors.Is(err, test.err) {
+			t.Errorf("%s: Expected %v, Got %v", test.goal, test.err, err)
+		}
+	}
+}
+
+func TestSubcircuits(t *testing.T) {
+	src := `SUBCKT(toggle)
+INPUT(en)
+OUTPUT(q)
+q = DFF(d)
+d = XOR(q, en)
+ENDS
+
+# Two toggles chained into a counter
+SUBCKT(counter)
+INPUT(en)
+OUTPUT(q0)
+OUTPUT(q1)
+u0 = toggle(en = en, q = q0)
+c = AND(en, q0)
+u1 = toggle(en = c, q = q1)
+ENDS
+
+INPUT(A)
+OUTPUT(Q1)
+c0 = counter(en = A, q1 = Q1)
+`
+	bench := loadTestBench(t, src, "c0.u1.q: c0.u0.q & c0.u1.q")
+
+	for _, name := range []string{"c0.en", "c0.u0.en", "c0.u0.q", "c0.u1.d", "c0.c", "Q1"} {
+		if _, ok := bench.portMap[name]; !ok {
+			t.Errorf("Expected a net named %s", name)
+		}
+	}
+	names := bench.gateNames()
+	var ffs []string
+	for _, id := range bench.ffs {
+		ffs = append(ffs, names[id])
+	}
+	if got := strings.Join(ffs, " "); got != "c0.u0.q c0.u1.q" {
+		t.Errorf("Expected flip flops c0.u0.q c0.u1.q, Got %s", got)
+	}
+
+	tests := []struct {
+		state, input, exp string
+	}{
+		{"00", "1", "10"},
+		{"10", "1", "01"},
+		{"11", "1", "00"},
+		{"01", "0", "01"},
+	}
+	for _, test := range tests {
+		if s := bench.NextState(test.state, test.input); s != test.exp {
+			t.Errorf("%s with inputs %s: Expected %s, Got %s", test.state, test.input, test.exp, s)
+		}
+	}
+	if ok, _ := bench.IsReachable(); !ok {
+		t.Error("Expected both toggles to turn on")
+	}
+
+	errTests := []struct {
+		src  string
+		line int
+		err  error
+	}{
+		{"INPUT(A)\nu1 = nothing(a = A)\n", 2, ErrUnknownGate},
+		{"SUBCKT(s)\nINPUT(a)\nENDS\nINPUT(A)\nu1 = s(b = A)\n", 5, ErrUnknownPort},
+		{"SUBCKT(s)\nINPUT(a)\nu = s(a = a)\nENDS\nINPUT(A)\nu1 = s(a = A)\n", 3, ErrRecursiveSubcircuit},
+		{"SUBCKT(s)\nINPUT(a)\nx = NOT(a)\nINPUT(A)\n", 4, ErrSyntax},
+		{"INPUT(A)\nENDS\n", 2, ErrSyntax},
+		{"SUBCKT(s)\nINPUT(a)\nINPUT(b)\nx = AND(a, b)\nENDS\nINPUT(A)\nu1 = s(b = A)\n", 4, ErrUndeclaredInput},
+	}
+	for _, test := range errTests {
+		_, err := New(strings.NewReader(test.src), "")
+		var perr *ParseError
+		if !errors.Is(err, test.err) || !errors.As(err, &perr) || perr.Line != test.line {
+			t.Errorf("%q: Expected %v on line %d, Got %v", test.src, test.err, test.line, err)
+		}
+	}
+}
+
+func TestConstants(t *testing.T) {
+	src := `INPUT(A)
+OUTPUT(Z)
+one = VDD()
+zero = GND()
+Q = DFF(d)
+d = AND(A, one)
+Z = OR(Q, zero, z1)
+z1 = AND(Q, c)
+c = CONST1()
+`
+	bench := loadTestBench(t, src, "Z")
+	if n := len(bench.inputs); n != 1 {
+		t.Errorf("Expected 1 input, Got %d", n)
+	}
+	if s := bench.NextState("0", "1"); s != "1" {
+		t.Errorf("Expected A to pass through the AND with VDD, Got %s", s)
+	}
+	if !bench.IsGoal("1") || bench.IsGoal("0") {
+		t.Error("Expected Z to follow Q")
+	}
+	checkGateClauses(t, bench)
+
+	// The AIG folds the constants away, leaving Q = A and Z = Q
+	g, lits := bench.toAIG()
+	if len(g.ands) != 0 {
+		t.Errorf("Expected the constants to fold away, Got %d ANDs", len(g.ands))
+	}
+	if z, q := lits[bench.gateOutputs["Z"]], lits[bench.gateOutputs["Q"]]; z != q {
+		t.Errorf("Expected Z to be the literal for Q (%d), Got %d", q, z)
+	}
+
+	// Constants come in from the other formats too
+	aag, err := NewAIGER(strings.NewReader("aag 1 1 0 2 0\n2\n1\n0\no0 hi\no1 lo\n"), "hi & !lo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	blif, err := NewBLIF(strings.NewReader(".outputs hi lo\n.names hi\n1\n.names lo\n.end\n"), "hi & !lo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := NewVerilog(strings.NewReader("module m(output hi, output lo);\nassign hi = 1'b1;\nbuf (lo, 0);\nendmodule\n"), "hi & !lo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range []*Bench{aag, blif, v} {
+		if !b.IsGoal("") {
+			t.Errorf("Expected hi to be on and lo off in:\n%v", b.lines)
+		}
+	}
+
+	for _, src := range []string{"INPUT(A)\nX = CONST0(A)\n", "INPUT(A)\nX = AND()\n"} {
+		if _, err := New(strings.NewReader(src), ""); !errors.Is(err, ErrGateArity) {
+			t.Errorf("%q: Expected %v, Got %v", src, ErrGateArity, err)
+		}
+	}
+}
+
+func TestLUTs(t *testing.T) {
+	src := `INPUT(A)
+INPUT(B)
+INPUT(C)
+Q0 = DFF(G0)
+Q1 = DFF(G1)
+Q2 = DFF(G2)
+Q3 = DFF(G3)
+G0 = LUT 0x8 (A, B)
+G1 = LUT 0x96 (A, B, C)
+G2 = LUT 0xE8 ( A, B, C )
+G3 = MUX(A, B, C)
+`
+	bench := loadTestBench(t, src, "0000")
+	for i := 0; i < 8; i++ {
+		a, b, c := i&4 != 0, i&2 != 0, i&1 != 0
+		mux := b
+		if a {
+			mux = c
+		}
+		// AND, three input parity, majority and the MUX
+		want := []bool{a && b, a != b != c, (a && b) || (a && c) || (b && c), mux}
+		input := fmt.Sprintf("%03b", i)
+		next := bench.NextState("0000", input)
+		for j, on := range want {
+			if (next[j] == '1') != on {
+				t.Errorf("Input %s: Expected Q%d to be %t, Got %s", input, j, on, next)
+			}
+		}
+	}
+	checkGateClauses(t, bench)
+
+	// Majority is covered by three two-input cubes each way, instead of a
+	// clause for every row of its table
+	if n := len(bench.lutClauses(bench.gateOutputs["G2"], 0)); n != 6 {
+		t.Errorf("Expected 6 clauses for majority, Got %d", n)
+	}
+
+	// The AIG has to agree with the runner
+	var buf bytes.Buffer
+	if err := bench.WriteAIGER(&buf); err != nil {
+		t.Fatal(err)
+	}
+	aag, err := NewAIGER(&buf, "0000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 8; i++ {
+		input := fmt.Sprintf("%03b", i)
+		if want, got := bench.NextState("0000", input), aag.NextState("0000", input); want != got {
+			t.Errorf("Input %s: Expected %s from the AIG, Got %s", input, want, got)
+		}
+	}
+
+	// Writing the bench file keeps the masks
+	buf.Reset()
+	if err := bench.WriteBench(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "G1 = LUT 0x96 (A, B, C)") {
+		t.Errorf("Expected the LUT to be written with its mask, Got:\n%s", buf.String())
+	}
+
+	for _, test := range []struct {
+		src string
+		err error
+	}{
+		{"INPUT(A)\nX = LUT 0x10 (A)\n", ErrLUTMask},
+		{"INPUT(A)\nX = LUT(A)\n", ErrLUTMask},
+		{"INPUT(A)\nX = AND 0x1 (A)\n", ErrSyntax},
+		{"INPUT(A)\nX = LUT 0x1 (A, A, A, A, A, A, A)\n", ErrGateArity},
+		{"INPUT(A)\nX = MUX(A, A)\n", ErrGateArity},
+	} {
+		if _, err := New(strings.NewReader(test.src), ""); !errors.Is(err, test.err) {
+			t.Errorf("%q: Expected %v, Got %v", test.src, test.err, err)
+		}
+	}
+}
+
+func TestFlipFlops(t *testing.T) {
+	src := `INPUT(D)
+INPUT(C)
+Q0 = DFF 1 (D)
+Q1 = DFFE(D, C)
+Q2 = DFFR X (D, C)
+Q3 = DFFS(D, C)
+`
+	bench := loadTestBench(t, src, "0000", WithUnroll(1))
+	for i := 0; i < 1<<6; i++ {
+		bits := fmt.Sprintf("%06b", i)
+		input, state := bits[:2], bits[2:]
+		d, c := input[0], input[1]
+		want := []byte{d, state[1], d, d}
+		if c == '1' {
+			want[1], want[2], want[3] = d, '0', '1'
+		}
+		if next := bench.NextState(state, input); next != string(want) {
+			t.Errorf("State %s, inputs %s: Expected %s, Got %s", state, input, want, next)
+		}
+	}
+	checkGateClauses(t, bench)
+
+	// A net named like the next value of a flip flop gets its own port
+	clash := loadTestBench(t, src+"Q4 = DFF(Q1$next)\nQ1$next = NOR(D, C)\n", "00000")
+	checkGateClauses(t, clash)
+
+	// The annotations give the initial state, unless it's given some other way
+	if states := bench.initialStates(); len(states) != 2 || states[0] != "1000" || states[1] != "1010" {
+		t.Errorf("Expected initial states [1000 1010], Got %v", states)
+	}
+	overridden := loadTestBench(t, src, "0000", WithInit("0001"))
+	if states := overridden.initialStates(); len(states) != 1 || states[0] != "0001" {
+		t.Errorf("Expected the option to win, Got %v", states)
+	}
+
+	// Round trips through the other formats keep the behavior
+	var buf bytes.Buffer
+	if err := bench.WriteBench(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"Q0 = DFF 1 (D)", "Q1 = DFFE(D, C)", "Q2 = DFFR X (D, C)"} {
+		if !strings.Contains(buf.String(), line) {
+			t.Errorf("Expected %q in:\n%s", line, buf.String())
+		}
+	}
+	buf.Reset()
+	if err := overridden.WriteAIGER(&buf); err != nil {
+		t.Fatal(err)
+	}
+	aag, err := NewAIGER(&buf, "0000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if err := bench.WriteVerilog(&buf); err != nil {
+		t.Fatal(err)
+	}
+	v, err := NewVerilog(&buf, "0000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if states := aag.initialStates(); len(states) != 1 || states[0] != "0001" {
+		t.Errorf("Expected the AIGER reset values to be 0001, Got %v", states)
+	}
+	for i := 0; i < 1<<6; i++ {
+		bits := fmt.Sprintf("%06b", i)
+		input, state := bits[:2], bits[2:]
+		want := bench.NextState(state, input)
+		if got := aag.NextState(state, input); got != want {
+			t.Errorf("AIGER: State %s, inputs %s: Expected %s, Got %s", state, input, want, got)
+		}
+		if got := v.NextState(state, input); got != want {
+			t.Errorf("Verilog: State %s, inputs %s: Expected %s, Got %s", state, input, want, got)
+		}
+	}
+
+	for _, src := range []string{"INPUT(A)\nQ = DFFE(A)\n", "INPUT(A)\nQ = DFFR(A, A, A)\n"} {
+		if _, err := New(strings.NewReader(src), ""); !errors.Is(err, ErrGateArity) {
+			t.Errorf("%q: Expected %v, Got %v", src, ErrGateArity, err)
+		}
+	}
+}
+
+func TestStats(t *testing.T) {
+	src := `INPUT(A)
+INPUT(B)
+OUTPUT(Z)
+Q0 = DFF(G0)
+Q1 = DFF(G1)
+Q2 = DFF(G2)
+G0 = XOR(Q1, A)
+G1 = AND(Q0, B)
+G2 = NOT(N)
+N = NOT(Q0)
+Z = OR(G2, Q2)
+`
+	s := loadTestBench(t, src, "000").Stats()
+	if s.Inputs != 2 || s.Outputs != 1 || s.FlipFlops != 3 {
+		t.Errorf("Expected 2 inputs, 1 output and 3 flip flops, Got %d, %d and %d", s.Inputs, s.Outputs, s.FlipFlops)
+	}
+	want := map[string]int{"DFF": 3, "XOR": 1, "AND": 1, "NOT": 2, "OR": 1}
+	if !reflect.DeepEqual(s.Gates, want) {
+		t.Errorf("Expected gates %v, Got %v", want, s.Gates)
+	}
+	// Q0 -> N -> G2 -> Z
+	if s.Depth != 3 {
+		t.Errorf("Expected 3 logic levels, Got %d", s.Depth)
+	}
+	// Q0 drives G1 and N
+	if s.MaxFanout != 2 {
+		t.Errorf("Expected a max fanout of 2, Got %d", s.MaxFanout)
+	}
+	// Q0 and Q1 feed each other, and Q2 is on its own
+	if s.SCCs != 2 || s.LargestSCC != 2 {
+		t.Errorf("Expected 2 SCCs, the largest with 2 flip flops, Got %d and %d", s.SCCs, s.LargestSCC)
+	}
+	if s.SearchBits() != 5 {
+		t.Errorf("Expected 5 search bits, Got %d", s.SearchBits())
+	}
+	if !strings.Contains(s.String(), "2^2 inputs x 2^3 states = 32 steps") {
+		t.Errorf("Expected the search cost in:\n%s", s)
+	}
+}
+
+func TestReduce(t *testing.T) {
+	// A two bit counter, next to a shift register that it doesn't care about
+	src := `INPUT(EN)
+INPUT(S)
+INPUT(T)
+C0 = DFF(N0)
+C1 = DFF(N1)
+R0 = DFF(S)
+R1 = DFF(X)
+X = XOR(R0, T)
+N0 = XOR(C0, EN)
+N1 = XOR(C1, K)
+K = AND(C0, EN)
+`
+	bench := loadTestBench(t, src, "11XX", WithInit("00X1"))
+	reduced, err := bench.Reduce()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reduced.inputs) != 1 || len(reduced.ffs) != 2 {
+		t.Fatalf("Expected 1 input and 2 flip flops left, Got %d and %d", len(reduced.inputs), len(reduced.ffs))
+	}
+	if reduced.Goal != "p0: 11" {
+		t.Errorf("Expected the goal to only have the counter, Got %q", reduced.Goal)
+	}
+
+	ok, states := reduced.IsReachable()
+	if !ok {
+		t.Fatal("Expected the counter to reach 11")
+	}
+	// The trace covers the whole circuit, and replays on it
+	lines := strings.Split(strings.TrimSpace(reduced.Solution(states)), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("Expected three steps to 11, Got:\n%s", strings.Join(lines, "\n"))
+	}
+	state := strings.Fields(lines[0])[1]
+	if !regexpMatch(t, `^00[01]1$`, state) {
+		t.Errorf("Expected an initial state of the whole circuit, Got %s", state)
+	}
+	for i, line := range lines[1:] {
+		// Each line has the state, then the inputs applied in it
+		prev := strings.Fields(lines[i])
+		state = bench.NextState(state, prev[len(prev)-1])
+		if !strings.Contains(line, ": "+state) {
+			t.Errorf("Expected %s, Got %s", state, line)
+		}
+	}
+	if !bench.IsGoal(state) {
+		t.Errorf("Expected the trace to end in the goal, Got %s", state)
+	}
+
+	// Properties keep the nets they read, including inputs
+	bench = loadTestBench(t, src, "C1 & T")
+	if reduced, err = bench.Reduce(); err != nil {
+		t.Fatal(err)
+	}
+	if len(reduced.inputs) != 2 || len(reduced.ffs) != 2 {
+		t.Errorf("Expected 2 inputs and 2 flip flops left, Got %d and %d", len(reduced.inputs), len(reduced.ffs))
+	}
+
+	// Goals that don't look at anything leave nothing to cut
+	bench = loadTestBench(t, src, "XXXX")
+	if reduced, _ := bench.Reduce(); reduced != bench {
+		t.Error("Expected a goal of all don't cares to keep the whole circuit")
+	}
+}
+
+func TestOptimize(t *testing.T) {
+	src := `INPUT(A)
+INPUT(B)
+OUTPUT(Z)
+Q0 = DFF(D0)
+Q1 = DFFE(D1, A)
+D0 = AND(A, B)
+D0b = AND(B, A)
+N1 = NOT(Q0)
+N2 = NOT(N1)
+one = VDD()
+D1 = AND(N2, one, D0b)
+Z = OR(D0, D1)
+unused = XOR(A, Q1)
+`
+	bench := loadTestBench(t, src, "11")
+	opt, report, err := bench.Optimize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bench.CheckEquivalent(opt); err != nil {
+		t.Error(err)
+	}
+	if _, ok := opt.gateOutputs["unused"]; ok {
+		t.Error("Expected the dangling XOR to be removed")
+	}
+	before, after := combinationalGates(report.Before), combinationalGates(report.After)
+	if after >= before {
+		t.Errorf("Expected fewer gates, Got %d -> %d\n%s", before, after, report)
+	}
+	if !strings.Contains(report.String(), "removed") {
+		t.Errorf("Expected the report to say what was removed, Got:\n%s", report)
+	}
+	ok, _ := opt.IsReachable()
+	if want, _ := bench.IsReachable(); ok != want {
+		t.Errorf("Expected reachability %t, Got %t", want, ok)
+	}
+
+	// Nets the goals read keep their names
+	bench = loadTestBench(t, src, "D1 & !Q1")
+	if opt, _, err = bench.Optimize(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bench.CheckEquivalent(opt); err != nil {
+		t.Error(err)
+	}
+
+	// Even when another goal doesn't read anything
+	bench = loadTestBench(t, src, "any: XX\nD1 & !Q1")
+	if opt, _, err = bench.Optimize(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := opt.gateOutputs["D1"]; !ok {
+		t.Error("Expected D1 to keep its name")
+	}
+
+	changed := loadTestBench(t, strings.Replace(src, "Z = OR(D0, D1)", "Z = AND(D0, D1)", 1), "11")
+	if err := bench.CheckEquivalent(changed); !errors.Is(err, ErrNotEquivalent) {
+		t.Errorf("Expected %v, Got %v", ErrNotEquivalent, err)
+	}
+}
+
+func TestNamedTraces(t *testing.T) {
+	src := `INPUT(en)
+INPUT(x[1])
+INPUT(x[0])
+cnt[0] = DFF(n0)
+flag = DFF(c0)
+cnt[1] = DFF(n1)
+odd[0] = DFF(x[0])
+odd[2] = DFF(x[1])
+n0 = XOR(cnt[0], en)
+c0 = AND(cnt[0], en)
+n1 = XOR(cnt[1], c0)
+`
+	bench := loadTestBench(t, src, "cnt == 2", WithNamedTraces())
+	steps := []State{{state: "00000", input: "110"}, {state: "10001", input: "101"}}
+	want := `Initial: cnt[1:0]=00 flag=0 odd[0]=0 odd[2]=0 Inputs: en=1 x[1:0]=10
+State 2: cnt[1:0]=01 flag=0 odd[0]=0 odd[2]=1 Inputs: en=1 x[1:0]=01
+Final: cnt[1:0]=10 flag=1 odd[0]=1 odd[2]=0 Inputs: en=0 x[1:0]=00
+`
+	if got := bench.formatTrace(steps, State{state: "01110", input: "000"}, true); got != want {
+		t.Errorf("Expected:\n%sGot:\n%s", want, got)
+	}
+
+	// Explicit search and the SAT output both use it
+	ok, states := bench.IsReachable()
+	if !ok {
+		t.Fatal("Expected cnt to reach 2")
+	}
+	if sol := bench.Solution(states); !regexpMatch(t, `Final: cnt\[1:0\]=10 flag=1 odd\[0\]=[01] odd\[2\]=[01] Inputs: en=[01] x\[1:0\]=[01]{2}\n$`, sol) {
+		t.Errorf("Expected a named trace, Got:\n%s", sol)
+	}
+	bench.Unroll = 1
+	out := "s SATISFIABLE\nv"
+	for port := 1; port <= bench.portCount(); port++ {
+		out += " " + strconv.Itoa(port)
+	}
+	if sol := bench.parseOutput(out+" 0\n", bench.firstGoal()); !strings.HasPrefix(sol, "Initial: cnt[1:0]=11 flag=1 odd[0]=1 odd[2]=1 Inputs: en=1 x[1:0]=11\n") {
+		t.Errorf("Expected a named trace, Got:\n%s", sol)
+	}
+}
+
+func TestWordSim(t *testing.T) {
+	// Enough inputs that some of them change between passes
+	src := `INPUT(I0)
+INPUT(I1)
+INPUT(I2)
+INPUT(I3)
+INPUT(I4)
+INPUT(I5)
+INPUT(I6)
+INPUT(I7)
+Q0 = DFF(G0)
+Q1 = DFFE(G1, I7)
+Q2 = DFFR(G2, I6)
+Q3 = DFFS(G3, I0)
+Q4 = DFF(G4)
+Q5 = DFF(G5)
+one = VDD()
+G0 = AND(I0, Q1, I2)
+G1 = NOR(I1, Q0, I3)
+G2 = XNOR(I4, Q2, I5, I1)
+G3 = MUX(I7, Q3, G2)
+G4 = LUT 0x96e8(I2, G0, Q4, I6)
+G5 = NAND(G1, one, Q5)
+`
+	bench := loadTestBench(t, src, "111111")
+	sim := newWordSim(bench)
+	for _, state := range []string{"000000", "101010", "010101", "111111"} {
+		sim.setState(state)
+		for first := 0; first < 256; first += lanes {
+			sim.setInputs(first)
+			sim.run()
+			for lane, got := range sim.states(lanes) {
+				input := inputMask(first+lane, len(bench.inputs))
+				if exp := bench.NextState(state, input); got != exp {
+					t.Errorf("State %s, inputs %s: Expected %s, Got %s", state, input, exp, got)
+				}
+			}
+		}
+	}
+}
+
+func TestCompile(t *testing.T) {
+	bench := loadTestBench(t, wideCircuit(8, 4), "1111")
+	// Every gate is computed before anything reads it
+	ready := make([]bool, len(bench.toInputs))
+	for _, id := range append(bench.inputs, bench.ffs...) {
+		ready[id] = true
+	}
+	for _, in := range bench.program {
+		for _, id := range in.ins {
+			if !ready[id] {
+				t.Errorf("Gate %d is read before it's computed", id)
+			}
+		}
+		ready[in.out] = true
+	}
+	if n := len(bench.program); n != bench.gateCount-len(bench.ffs) {
+		t.Errorf("Expected an instruction for each of the %d combinational gates, Got %d", bench.gateCount-len(bench.ffs), n)
+	}
+}
+
+func TestTernary(t *testing.T) {
+	// Each flip flop latches a single gate, so a bit should only be unknown
+	// when the unknown inputs really can change it
+	src := `INPUT(A)
+INPUT(B)
+INPUT(S)
+Q0 = DFF(G0)
+Q1 = DFF(G1)
+Q2 = DFF(G2)
+Q3 = DFF(G3)
+Q4 = DFF(G4)
+Q5 = DFF(G5)
+Q6 = DFF(G6)
+Q7 = DFF(G7)
+Q8 = DFF(G8)
+Q9 = DFF(G9)
+Q10 = DFFE(A, S)
+Q11 = DFFR(A, B)
+Q12 = DFFS(A, B)
+Q13 = DFF(G13)
+G0 = AND(A, B)
+G1 = OR(A, B)
+G2 = NAND(A, B)
+G3 = NOR(A, B)
+G4 = XOR(A, B)
+G5 = XNOR(A, B)
+G6 = NOT(A)
+G7 = BUFF(B)
+G8 = MUX(S, A, B)
+G9 = LUT 0xe8(A, B, S)
+zero = GND()
+G13 = AND(zero, A)
+`
+	bench := loadTestBench(t, src, "XXXXXXXXXXXXXX")
+	// Every way of filling in the Xs of bits
+	var completions func(bits string) []string
+	completions = func(bits string) []string {
+		i := strings.IndexByte(bits, 'X')
+		if i < 0 {
+			return []string{bits}
+		}
+		return append(completions(bits[:i]+"0"+bits[i+1:]), completions(bits[:i]+"1"+bits[i+1:])...)
+	}
+	values := []string{"0", "1", "X"}
+	for c := 0; c < 81; c++ {
+		input := values[c%3] + values[c/3%3] + values[c/9%3]
+		state := "0000000000" + values[c/27%3] + "000"
+		got, err := bench.NextTernaryState(state, input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var exp []byte
+		for _, s := range completions(state) {
+			for _, in := range completions(input) {
+				next := bench.NextState(s, in)
+				if exp == nil {
+					exp = []byte(next)
+				}
+				for i := range next {
+					if next[i] != exp[i] {
+						exp[i] = 'X'
+					}
+				}
+			}
+		}
+		if got != string(exp) {
+			t.Errorf("State %s, inputs %s: Expected %s, Got %s", state, input, exp, got)
+		}
+	}
+
+	if _, err := bench.NextTernaryState("00", "000"); !errors.Is(err, ErrInit) {
+		t.Errorf("Expected %v, Got %v", ErrInit, err)
+	}
+	if _, err := bench.NextTernaryState(strings.Repeat("0", 14), "0"); !errors.Is(err, ErrInputs) {
+		t.Errorf("Expected %v, Got %v", ErrInputs, err)
+	}
+}
+
+func TestCheckReset(t *testing.T) {
+	src := `INPUT(rst)
+INPUT(en)
+c0 = DFFR(n0, rst)
+c1 = DFFR(n1, rst)
+hold = DFFE(c1, en)
+n0 = XOR(c0, en)
+carry = AND(c0, en)
+n1 = XOR(c1, carry)
+`
+	bench := loadTestBench(t, src, "111")
+	trace, ok, err := bench.CheckReset("10", "1X")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Errorf("Expected hold to stay unknown without an enable, Got:\n%s", trace)
+	}
+	want := "Initial: XXX Inputs: 10\nState 2: 00X Inputs: 1X\nFinal: 00X\n"
+	if trace != want {
+		t.Errorf("Expected:\n%sGot:\n%s", want, trace)
+	}
+
+	if trace, ok, _ = bench.CheckReset("10", "11"); !ok {
+		t.Errorf("Expected the circuit to be reset, Got:\n%s", trace)
+	}
+	states, err := bench.TernarySimulate("XX1", "00", "01", "X1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"XX1", "XXX", "XXX"}; !reflect.DeepEqual(states, want) {
+		t.Errorf("Expected %v, Got %v", want, states)
+	}
+}
@@ -0,0 +1,275 @@
+package bench
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// The kinds of problems we can run into reading a BLIF file, on top of the
+// ones checkLines looks for
+var (
+	ErrBLIFCover       = errors.New("malformed .names cover")
+	ErrBLIFUnsupported = errors.New("unsupported BLIF feature")
+)
+
+// NewBLIF reads a flattened BLIF netlist from r. Each .names cover is turned
+// into a sum of products built out of NOT, AND and OR gates, or a constant if
+// it doesn't depend on its inputs, and each .latch becomes a DFF with its
+// initial value. Latches with a don't care or unknown initial value can start
+// with either value.
+func NewBLIF(r io.Reader, goal string, opts ...Option) (*Bench, error) {
+	bench := newBench(goal, opts)
+	p := &blifReader{name: bench.name, used: make(map[string]bool)}
+	if err := p.read(r); err != nil {
+		return nil, err
+	}
+
+	bench.lines = p.lines
+	bench.defaultInit(string(p.init))
+	if err := bench.load(); err != nil {
+		return nil, err
+	}
+	return bench, nil
+}
+
+// A single .names block, with the nets it reads and writes and its cover
+type blifNames struct {
+	inputs []string
+	output string
+	rows   [][2]string
+
+	// Where the block came from, for error messages
+	num  int
+	text string
+}
+
+type blifReader struct {
+	name string
+
+	// The lines of the equivalent bench file
+	lines []fileLine
+	// The initial value of each latch
+	init []byte
+
+	names []*blifNames
+
+	// Every net name in the file, so that the nets we make up don't collide
+	used map[string]bool
+	// The inverted nets we've already made, by the net they invert
+	inverted map[string]string
+}
+
+func (p *blifReader) lineErr(num int, text string, err error) error {
+	return &ParseError{File: p.name, Line: num, Text: text, Err: err}
+}
+
+// Cleans up a net name and records that it's in use
+func (p *blifReader) net(name string) string {
+	name = badNetCharRE.ReplaceAllString(name, "_")
+	p.used[name] = true
+	return name
+}
+
+func (p *blifReader) read(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	num, start := 0, 0
+	var line string
+	var current *blifNames
+	for scanner.Scan() {
+		num++
+		text := scanner.Text()
+		if i := strings.Index(text, "#"); i >= 0 {
+			text = text[:i]
+		}
+		// A trailing backslash continues the statement on the next line
+		if line == "" {
+			start = num
+		}
+		if strings.HasSuffix(strings.TrimSpace(text), "\\") {
+			line += strings.TrimSuffix(strings.TrimSpace(text), "\\") + " "
+			continue
+		}
+		line = strings.TrimSpace(line + text)
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		stmt := line
+		line = ""
+		if !strings.HasPrefix(fields[0], ".") {
+			// Anything that isn't a keyword is a row of the current cover
+			if current == nil {
+				return p.lineErr(start, stmt, ErrSyntax)
+			}
+			var row [2]string
+			switch {
+			case len(fields) == 1 && len(current.inputs) == 0:
+				row[1] = fields[0]
+			case len(fields) == 2 && len(fields[0]) == len(current.inputs):
+				row = [2]string{fields[0], fields[1]}
+			default:
+				return p.lineErr(start, stmt, ErrBLIFCover)
+			}
+			if strings.Trim(row[0], "01-") != "" || (row[1] != "0" && row[1] != "1") {
+				return p.lineErr(start, stmt, ErrBLIFCover)
+			}
+			current.rows = append(current.rows, row)
+			continue
+		}
+
+		current = nil
+		switch fields[0] {
+		case ".model", ".end", ".clock":
+		case ".inputs", ".outputs":
+			for _, name := range fields[1:] {
+				fl := fileLine{output: p.net(name), gateType: strings.ToUpper(fields[0][1 : len(fields[0])-1]), isIO: true}
+				fl.num, fl.text = start, stmt
+				p.lines = append(p.lines, fl)
+			}
+		case ".names":
+			if len(fields) < 2 {
+				return p.lineErr(start, stmt, ErrSyntax)
+			}
+			current = &blifNames{output: p.net(fields[len(fields)-1]), num: start, text: stmt}
+			for _, name := range fields[1 : len(fields)-1] {
+				current.inputs = append(current.inputs, p.net(name))
+			}
+			p.names = append(p.names, current)
+		case ".latch":
+			if len(fields) < 3 || len(fields) > 6 {
+				return p.lineErr(start, stmt, ErrSyntax)
+			}
+			fl := fileLine{output: p.net(fields[2]), inputs: []string{p.net(fields[1])}, gateType: "DFF"}
+			fl.num, fl.text = start, stmt
+			p.lines = append(p.lines, fl)
+
+			// The initial value is last, and is optional whether or not
+			// there's a type and control net
+			init := byte('0')
+			if len(fields) == 4 || len(fields) == 6 {
+				v, err := strconv.Atoi(fields[len(fields)-1])
+				if err != nil || v < 0 || v > 3 {
+					return p.lineErr(start, stmt, ErrSyntax)
+				}
+				switch v {
+				case 1:
+					init = '1'
+				case 2, 3:
+					init = 'X'
+				}
+			}
+			p.init = append(p.init, init)
+		default:
+			return p.lineErr(start, stmt, fmt.Errorf("%w: %s", ErrBLIFUnsupported, fields[0]))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	p.inverted = make(map[string]string)
+	for _, names := range p.names {
+		if err := p.addCover(names); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Makes up a new net name based on the given one
+func (p *blifReader) uniqueName(name string) string {
+	for p.used[name] {
+		name += "_"
+	}
+	p.used[name] = true
+	return name
+}
+
+func (p *blifReader) addLine(names *blifNames, output, gateType string, inputs ...string) {
+	fl := fileLine{output: output, inputs: inputs, gateType: gateType}
+	fl.num, fl.text = names.num, names.text
+	p.lines = append(p.lines, fl)
+}
+
+// The name of a net with the opposite value of the given one
+func (p *blifReader) invert(names *blifNames, net string) string {
+	if inv, ok := p.inverted[net]; ok {
+		return inv
+	}
+	inv := p.uniqueName(net + "_n")
+	p.addLine(names, inv, "NOT", net)
+	p.inverted[net] = inv
+	return inv
+}
+
+// Turns a .names block into gates. Each row of the cover is a product term,
+// and the output is the OR of them, or the NOR if the cover lists the rows
+// where the output is off.
+func (p *blifReader) addCover(names *blifNames) error {
+	var onSet, offSet bool
+	for _, row := range names.rows {
+		onSet = onSet || row[1] == "1"
+		offSet = offSet || row[1] == "0"
+	}
+	if onSet && offSet {
+		return p.lineErr(names.num, names.text, ErrBLIFCover)
+	}
+
+	// The net for each product term, which is a single input or an AND gate
+	var terms []string
+	for i, row := range names.rows {
+		var lits []string
+		for j, c := range row[0] {
+			switch c {
+			case '1':
+				lits = append(lits, names.inputs[j])
+			case '0':
+				lits = append(lits, p.invert(names, names.inputs[j]))
+			}
+		}
+		switch {
+		case len(lits) == 0:
+			// A row of all don't cares means the output is constant
+			gate := "CONST1"
+			if offSet {
+				gate = "CONST0"
+			}
+			p.addLine(names, names.output, gate)
+			return nil
+		case len(lits) == 1:
+			terms = append(terms, lits[0])
+		case len(names.rows) == 1:
+			// No need for a separate net when the term is the whole cover
+			gate := "AND"
+			if offSet {
+				gate = "NAND"
+			}
+			p.addLine(names, names.output, gate, lits...)
+			return nil
+		default:
+			term := p.uniqueName(names.output + "_" + strconv.Itoa(i))
+			p.addLine(names, term, "AND", lits...)
+			terms = append(terms, term)
+		}
+	}
+
+	switch {
+	case len(terms) == 0:
+		// An empty cover is never on
+		p.addLine(names, names.output, "CONST0")
+	case len(terms) == 1 && offSet:
+		p.addLine(names, names.output, "NOT", terms[0])
+	case len(terms) == 1:
+		p.addLine(names, names.output, "BUFF", terms[0])
+	case offSet:
+		p.addLine(names, names.output, "NOR", terms...)
+	default:
+		p.addLine(names, names.output, "OR", terms...)
+	}
+	return nil
+}
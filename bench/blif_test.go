@@ -0,0 +1,76 @@
+package bench
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// The same counter as counterAAG
+const counterBLIF = `.model counter
+.inputs en
+.outputs bad en_low
+# The high bit resets to 1
+.latch q0_next q0 re clk 0
+.latch q1_next q1 1
+.names q0 en q0_next
+10 1
+01 1
+.names q1 q0 en \
+  q1_next
+10- 1
+1-0 1
+011 1
+.names q0 q1 bad
+11 1
+.names en en_low
+1 0
+.end
+`
+
+func TestBLIF(t *testing.T) {
+	bench, err := NewBLIF(strings.NewReader(counterBLIF), "11")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if init := bench.initPatterns()[0]; init != "01" {
+		t.Errorf("Expected initial state 01, Got %s", init)
+	}
+
+	tests := []struct {
+		state, input, exp string
+	}{
+		{"00", "0", "00"},
+		{"00", "1", "10"},
+		{"10", "1", "01"},
+		{"11", "1", "00"},
+		{"11", "0", "11"},
+	}
+	for _, test := range tests {
+		if s := bench.NextState(test.state, test.input); s != test.exp {
+			t.Errorf("%s with inputs %s: Expected %s, Got %s", test.state, test.input, test.exp, s)
+		}
+	}
+	checkGateClauses(t, bench)
+}
+
+func TestBLIFErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		line int
+		err  error
+	}{
+		{".inputs a\n.names a b\n1 1\n0 0\n", 2, ErrBLIFCover},
+		{".inputs a\n.names a b\n11 1\n", 3, ErrBLIFCover},
+		{".inputs a\n.subckt foo x=a\n", 2, ErrBLIFUnsupported},
+		{".inputs a\n.names a c b\n11 1\n", 2, ErrUndeclaredInput},
+	}
+	for _, test := range tests {
+		_, err := NewBLIF(strings.NewReader(test.src), "")
+		var perr *ParseError
+		if !errors.As(err, &perr) || !errors.Is(err, test.err) || perr.Line != test.line {
+			t.Errorf("%q: Expected %v on line %d, Got %v", test.src, test.err, test.line, err)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package bench
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// The kinds of problems checkLines can find in a netlist. A ParseError wraps
+// one of these, so callers can test for them with errors.Is
+var (
+	ErrSyntax            = errors.New("unrecognized statement")
+	ErrUnknownGate       = errors.New("unknown gate type")
+	ErrGateArity         = errors.New("wrong number of gate inputs")
+	ErrMultipleDrivers   = errors.New("net has more than one driver")
+	ErrUndeclaredInput   = errors.New("net is read but never driven or declared as an INPUT")
+	ErrUndriven          = errors.New("output net is never driven")
+	ErrCombinationalLoop = errors.New("combinational loop")
+	ErrLUTMask           = errors.New("LUT mask doesn't fit its inputs")
+)
+
+// The gate types that hold state
+var flipFlops = map[string]bool{"DFF": true, "DFFE": true, "DFFR": true, "DFFS": true}
+
+// ErrGoal, ErrInit and ErrInputs are returned when the goal, initial states
+// or inputs don't fit the circuit
+var (
+	ErrGoal   = errors.New("malformed goal state")
+	ErrInit   = errors.New("malformed initial state")
+	ErrInputs = errors.New("malformed inputs")
+)
+
+// A ParseError describes a problem with a single line of a netlist
+type ParseError struct {
+	File string
+	Line int
+	Text string
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s:%d: %v: %s", e.File, e.Line, e.Err, e.Text)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// The number of inputs each gate type takes, -1 meaning one or more
+var gateArity = map[string]int{
+	"AND":    -1,
+	"OR":     -1,
+	"NAND":   -1,
+	"NOR":    -1,
+	"XOR":    -1,
+	"XNOR":   -1,
+	"NOT":    1,
+	"BUFF":   1,
+	"DFF":    1,
+	"DFFE":   2,
+	"DFFR":   2,
+	"DFFS":   2,
+	"MUX":    3,
+	"LUT":    -1,
+	"CONST0": 0,
+	"CONST1": 0,
+	"GND":    0,
+	"VDD":    0,
+}
+
+// Strips comments and surrounding whitespace from a line of a bench file
+func cleanLine(line string) string {
+	if i := strings.Index(line, "#"); i >= 0 {
+		line = line[:i]
+	}
+	return strings.TrimSpace(line)
+}
+
+// checkLines makes sure the netlist describes a well formed circuit before we
+// try to build it, returning a *ParseError for the first problem found
+func checkLines(filename string, f []fileLine) error {
+	lineErr := func(line fileLine, err error) error {
+		return &ParseError{File: filename, Line: line.num, Text: line.text, Err: err}
+	}
+
+	// Indexed by net name, the line that drives it
+	drivers := make(map[string]int)
+	for i, line := range f {
+		switch {
+		case line.gateType == "":
+			return lineErr(line, ErrSyntax)
+		case line.isIO:
+			if line.gateType != "INPUT" && line.gateType != "OUTPUT" {
+				return lineErr(line, ErrUnknownGate)
+			}
+		default:
+			arity, ok := gateArity[line.gateType]
+			if !ok {
+				return lineErr(line, ErrUnknownGate)
+			}
+			if (arity < 0 && len(line.inputs) == 0) || (arity >= 0 && len(line.inputs) != arity) {
+				return lineErr(line, ErrGateArity)
+			}
+			if err := checkParam(line); err != nil {
+				return lineErr(line, err)
+			}
+		}
+
+		if line.gateType == "OUTPUT" {
+			continue
+		}
+		if _, ok := drivers[line.output]; ok {
+			return lineErr(line, ErrMultipleDrivers)
+		}
+		drivers[line.output] = i
+	}
+
+	for _, line := range f {
+		if line.gateType == "OUTPUT" {
+			if _, ok := drivers[line.output]; !ok {
+				return lineErr(line, ErrUndriven)
+			}
+		}
+		for _, in := range line.inputs {
+			if _, ok := drivers[in]; !ok {
+				return lineErr(line, fmt.Errorf("%w: %s", ErrUndeclaredInput, in))
+			}
+		}
+	}
+
+	return checkLoops(f, drivers, lineErr)
+}
+
+// Only LUTs and flip flops take a parameter. A LUT's mask needs a bit for
+// each combination of its inputs and no more, and a flip flop's initial
+// value is a single bit or X.
+func checkParam(line fileLine) error {
+	if flipFlops[line.gateType] {
+		if len(line.param) > 1 {
+			return ErrInit
+		}
+		return nil
+	}
+	if line.gateType != "LUT" {
+		if line.param != "" {
+			return ErrSyntax
+		}
+		return nil
+	}
+	if len(line.inputs) > maxLUTInputs {
+		return ErrGateArity
+	}
+	mask, err := parseMask(line.param)
+	if err != nil {
+		return ErrLUTMask
+	}
+	if bits := uint(1) << uint(len(line.inputs)); bits < 64 && mask>>bits != 0 {
+		return ErrLUTMask
+	}
+	return nil
+}
+
+// Looks for a cycle of gates that doesn't pass through a flip flop
+func checkLoops(f []fileLine, drivers map[string]int, lineErr func(fileLine, error) error) error {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(f))
+	// The lines on the current search path, for reporting the loop
+	var path []int
+
+	var visit func(i int) error
+	visit = func(i int) error {
+		state[i] = visiting
+		path = append(path, i)
+		// Flip flops break combinational paths, so we don't follow their inputs
+		if !flipFlops[f[i].gateType] {
+			for _, in := range f[i].inputs {
+				j := drivers[in]
+				switch state[j] {
+				case visiting:
+					var nets []string
+					for k := len(path) - 1; k >= 0; k-- {
+						nets = append(nets, f[path[k]].output)
+						if path[k] == j {
+							break
+						}
+					}
+					nets = append(nets, f[i].output)
+					loop := strings.Join(nets, " -> ")
+					return lineErr(f[j], fmt.Errorf("%w: %s", ErrCombinationalLoop, loop))
+				case unvisited:
+					if err := visit(j); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[i] = visited
+		return nil
+	}
+
+	for i := range f {
+		if state[i] == unvisited && !f[i].isIO {
+			if err := visit(i); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Makes sure each line of the goal has a 0, 1 or don't care for every flip
+// flop, or is a property of the circuit's nets. An empty goal is fine, for
+// when we aren't looking for anything in particular.
+func (b *Bench) checkGoal() error {
+	return b.parseGoals()
+}
+
+// Makes sure every initial state has a 0, 1 or don't care for every flip
+// flop, and turns all of the don't cares into Xs
+func (b *Bench) checkInit() error {
+	for i, state := range b.init {
+		if err := b.checkState(state, ErrInit); err != nil {
+			return err
+		}
+		b.init[i] = strings.Map(func(r rune) rune {
+			if isDontCare(byte(r)) {
+				return 'X'
+			}
+			return r
+		}, state)
+	}
+	return nil
+}
+
+func (b *Bench) checkState(state string, kind error) error {
+	return checkBits(state, len(b.ffs), "flip flops", kind)
+}
+
+func (b *Bench) checkInputs(inputs string) error {
+	return checkBits(inputs, len(b.inputs), "inputs", ErrInputs)
+}
+
+// Checks that there's a 0, 1, X or - for each of n flip flops or inputs
+func checkBits(bits string, n int, what string, kind error) error {
+	if len(bits) != n {
+		return fmt.Errorf("%w: %d bits for %d %s", kind, len(bits), n, what)
+	}
+	for i := range bits {
+		if bits[i] != '0' && bits[i] != '1' && !isDontCare(bits[i]) {
+			return fmt.Errorf("%w: %q is not 0, 1, X or -", kind, bits[i])
+		}
+	}
+	return nil
+}
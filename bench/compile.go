@@ -0,0 +1,56 @@
+package bench
+
+// What an instruction does with the values of its inputs
+type opcode int
+
+const (
+	opConst opcode = iota
+	opAND
+	opOR
+	opXOR
+	opBUFF
+	opMUX
+	opLUT
+)
+
+// An instruction works out the value of a single combinational gate
+type instr struct {
+	op  opcode
+	out int
+	ins []int
+
+	// Whether the result is flipped, for NAND, NOR, XNOR, NOT and CONST1
+	invert bool
+
+	// The truth table of a LUT
+	mask uint64
+}
+
+// Compiles the combinational gates into a flat list of instructions, in
+// topological order, so a step of the circuit is a single pass over it once
+// the inputs and flip flops are set
+func (b *Bench) compile() []instr {
+	order := b.topoOrder()
+	program := make([]instr, 0, len(order))
+	for _, id := range order {
+		in := instr{out: id, ins: b.toInputs[id]}
+		switch gt := b.gateType[id]; {
+		case gt.and, gt.nand:
+			in.op, in.invert = opAND, gt.nand
+		case gt.or, gt.nor:
+			in.op, in.invert = opOR, gt.nor
+		case gt.xor, gt.xnor:
+			in.op, in.invert = opXOR, gt.xnor
+		case gt.buff, gt.not:
+			in.op, in.invert = opBUFF, gt.not
+		case gt.mux:
+			in.op = opMUX
+		case gt.lut:
+			in.op, in.mask = opLUT, b.luts[id]
+		case gt.const0, gt.const1:
+			in.op, in.invert = opConst, gt.const1
+		}
+		program = append(program, in)
+	}
+	return program
+}
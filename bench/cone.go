@@ -0,0 +1,211 @@
+package bench
+
+import (
+	"strings"
+)
+
+// coneOfInfluence marks every gate that can affect the given gates, directly
+// or through any number of flip flops
+func (b *Bench) coneOfInfluence(ids []int) []bool {
+	inCone := make([]bool, len(b.toInputs))
+	stack := append([]int{}, ids...)
+	for _, id := range ids {
+		inCone[id] = true
+	}
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, in := range b.toInputs[id] {
+			if !inCone[in] {
+				inCone[in] = true
+				stack = append(stack, in)
+			}
+		}
+	}
+	return inCone
+}
+
+// The gates the goals look at, for cutting the circuit down to them. It's nil
+// if some goal doesn't look at anything, since then it's met right away.
+func (b *Bench) goalGates() []int {
+	for _, g := range b.goals {
+		if len(b.goalReads(g)) == 0 {
+			return nil
+		}
+	}
+	return b.allGoalGates()
+}
+
+// Every gate any of the goals look at
+func (b *Bench) allGoalGates() []int {
+	var ids []int
+	for _, g := range b.goals {
+		ids = append(ids, b.goalReads(g)...)
+	}
+	return ids
+}
+
+// The gates a goal looks at: the flip flops a state goal cares about, or the
+// nets named in a property
+func (b *Bench) goalReads(g *goal) []int {
+	if g.prop != nil {
+		return propGates(g.prop.root)
+	}
+	var ids []int
+	for i := range g.state {
+		if !isDontCare(g.state[i]) {
+			ids = append(ids, b.ffs[i])
+		}
+	}
+	return ids
+}
+
+// Every gate a checked property reads
+func propGates(e *propExpr) []int {
+	ids := append([]int{}, e.ids...)
+	for _, arg := range e.args {
+		ids = append(ids, propGates(arg)...)
+	}
+	return ids
+}
+
+// Reduce cuts the circuit down to the cone of influence of its goals, the
+// gates, flip flops and inputs that can affect the ones the goals look at.
+// Searching the reduced circuit gives the same answers with fewer states and
+// inputs to try, and its traces are replayed on the whole circuit, so they
+// still show every flip flop and input. States from ReachableStates and
+// CheckGoals only have the flip flops in the cone, though. If there's nothing
+// to cut away, the circuit itself is returned.
+func (b *Bench) Reduce() (*Bench, error) {
+	ids := b.goalGates()
+	if len(ids) == 0 {
+		return b, nil
+	}
+	inCone := b.coneOfInfluence(ids)
+
+	var lines []fileLine
+	removed := 0
+	for _, line := range b.lines {
+		if !inCone[b.gateOutputs[line.output]] {
+			removed++
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if removed == 0 {
+		return b, nil
+	}
+
+	var ffs, inputs []int
+	for i, id := range b.ffs {
+		if inCone[id] {
+			ffs = append(ffs, i)
+		}
+	}
+	for i, id := range b.inputs {
+		if inCone[id] {
+			inputs = append(inputs, i)
+		}
+	}
+
+	// The goals and initial states only keep the bits of the flip flops
+	// that are left
+	project := func(state string) string {
+		buf := make([]byte, len(ffs))
+		for i, pos := range ffs {
+			buf[i] = state[pos]
+		}
+		return string(buf)
+	}
+	var goals []string
+	for _, g := range b.goals {
+		src := g.src
+		if g.prop == nil {
+			src = project(g.state)
+		}
+		goals = append(goals, g.name+": "+src)
+	}
+	var init []string
+	seen := make(map[string]bool)
+	for _, pattern := range b.initPatterns() {
+		if p := project(pattern); !seen[p] {
+			seen[p] = true
+			init = append(init, p)
+		}
+	}
+
+	opts := []Option{WithRunners(b.RunnerCount), WithUnroll(b.Unroll), WithLogLevel(b.LogLevel), WithName(b.name), WithInit(init...)}
+	reduced := newBench(strings.Join(goals, "\n"), opts)
+	reduced.lines = lines
+	if err := reduced.load(); err != nil {
+		return nil, err
+	}
+	reduced.full = &fullCircuit{b: b, ffs: ffs, inputs: inputs}
+	return reduced, nil
+}
+
+// The circuit a reduced one was cut down from, with the position in it of
+// each of the flip flops and inputs that were kept
+type fullCircuit struct {
+	b      *Bench
+	ffs    []int
+	inputs []int
+}
+
+// Fills in the flip flops and inputs that were cut away, starting from an
+// initial state of the whole circuit that agrees with the reduced one, and
+// turning off the inputs that didn't matter
+func (f *fullCircuit) expand(steps []State, final State) ([]State, State) {
+	fill := func(bits string, pos []int, base []byte) string {
+		for i, p := range pos {
+			base[p] = bits[i]
+		}
+		return string(base)
+	}
+	input := func(bits string) string {
+		return fill(bits, f.inputs, []byte(strings.Repeat("0", len(f.b.inputs))))
+	}
+
+	start := final.state
+	if len(steps) > 0 {
+		start = steps[0].state
+	}
+	state := f.initialState(start)
+
+	full := make([]State, len(steps))
+	for i, step := range steps {
+		full[i] = State{state: state, input: input(step.input)}
+		state = f.b.NextState(state, full[i].input)
+	}
+	last := State{state: state}
+	if final.input != "" {
+		last.input = input(final.input)
+	}
+	return full, last
+}
+
+// An initial state of the whole circuit with the given bits for the flip
+// flops that were kept, taking the rest from the first pattern that fits
+func (f *fullCircuit) initialState(reduced string) string {
+	patterns := f.b.initPatterns()
+	pattern := patterns[0]
+	for _, p := range patterns {
+		fits := true
+		for i, pos := range f.ffs {
+			if p[pos] != 'X' && p[pos] != reduced[i] {
+				fits = false
+				break
+			}
+		}
+		if fits {
+			pattern = p
+			break
+		}
+	}
+
+	state := []byte(strings.Replace(pattern, "X", "0", -1))
+	for i, pos := range f.ffs {
+		state[pos] = reduced[i]
+	}
+	return string(state)
+}
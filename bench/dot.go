@@ -0,0 +1,83 @@
+package bench
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// The gate IDs of the named flip flops
+func (b *Bench) ffIDs(names []string) ([]int, error) {
+	var ids []int
+	for _, name := range names {
+		id, ok := b.gateOutputs[name]
+		if !ok || !b.gateType[id].ff {
+			return nil, fmt.Errorf("%s is not a flip flop", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// WriteDOT draws the circuit as a Graphviz graph. Each gate is labelled with
+// its type and the net it drives, flip flops are drawn as boxes, and the
+// edges into flip flops are dashed, since they carry values to the next step.
+// If any flip flops are named in highlight, their cone of influence is drawn
+// in red.
+func (b *Bench) WriteDOT(w io.Writer, highlight ...string) error {
+	ids, err := b.ffIDs(highlight)
+	if err != nil {
+		return err
+	}
+	inCone := make([]bool, len(b.toInputs))
+	if len(ids) > 0 {
+		inCone = b.coneOfInfluence(ids)
+	}
+
+	isOutput := make(map[int]bool)
+	for _, out := range b.outputs {
+		isOutput[b.gateOutputs[out]] = true
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "digraph %s {\n", strconv.Quote(b.name))
+	fmt.Fprintln(bw, "  rankdir=LR;")
+	for id, name := range b.gateNames() {
+		gt := b.gateType[id]
+		attrs := "shape=ellipse"
+		switch {
+		case gt.input:
+			attrs = "shape=invtriangle"
+		case gt.ff:
+			attrs = "shape=box, style=bold"
+		}
+		if isOutput[id] {
+			attrs += ", peripheries=2"
+		}
+		if inCone[id] {
+			attrs += ", color=red, fontcolor=red"
+		}
+		fmt.Fprintf(bw, "  g%d [label=%s, %s];\n", id, strconv.Quote(gt.String()+"\n"+name), attrs)
+	}
+	for id, ins := range b.toInputs {
+		for _, in := range ins {
+			var attrs []string
+			if b.gateType[id].ff {
+				// Keep feedback from dragging flip flops back to the left
+				attrs = append(attrs, "style=dashed", "constraint=false")
+			}
+			if inCone[id] && inCone[in] {
+				attrs = append(attrs, "color=red")
+			}
+			fmt.Fprintf(bw, "  g%d -> g%d", in, id)
+			if len(attrs) > 0 {
+				fmt.Fprintf(bw, " [%s]", strings.Join(attrs, ", "))
+			}
+			fmt.Fprintln(bw, ";")
+		}
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
@@ -0,0 +1,175 @@
+package bench
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Goals made up of nothing but bits and don't cares are flip flop states,
+// anything else is a property of the nets
+var stateGoalRE = regexp.MustCompile(`^[01Xx-]+$`)
+
+// A goal can be given a name, like "overflow: cnt == 7"
+var namedGoalRE = regexp.MustCompile(`^([\w.$]+)\s*:\s*(.*)$`)
+
+// A single thing we're looking for, which is either a state with don't cares
+// or a property of the nets
+type goal struct {
+	name string
+	src  string
+
+	state string
+	prop  *Property
+}
+
+// Splits the goal up into one goal per line, checking each one. Goals
+// without a name are named p0, p1, etc. by their position.
+func (b *Bench) parseGoals() error {
+	for _, line := range strings.Split(b.Goal, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		g := &goal{name: "p" + strconv.Itoa(len(b.goals)), src: line}
+		if m := namedGoalRE.FindStringSubmatch(line); m != nil {
+			g.name, g.src = m[1], strings.TrimSpace(m[2])
+		}
+
+		if stateGoalRE.MatchString(g.src) {
+			if err := b.checkState(g.src, ErrGoal); err != nil {
+				return err
+			}
+			g.state = g.src
+		} else {
+			p, err := ParseProperty(g.src)
+			if err == nil {
+				err = b.CheckProperty(p)
+			}
+			if err != nil {
+				return fmt.Errorf("%w: %w", ErrGoal, err)
+			}
+			g.prop = p
+		}
+		b.goals = append(b.goals, g)
+	}
+	return nil
+}
+
+// Whether the state meets the goal, where X or - in a goal state matches
+// either value, and a property is met when some inputs make it true
+func (b *Bench) matches(g *goal, state string) bool {
+	if g.prop != nil {
+		_, ok := b.goalRunner.satisfyingInputs(state, g.prop)
+		return ok
+	}
+	if len(state) != len(g.state) {
+		return false
+	}
+	for i := range g.state {
+		if !isDontCare(g.state[i]) && g.state[i] != state[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Tries every combination of inputs in the given state, looking for one
+// where the property holds
+func (r *runner) satisfyingInputs(state string, p *Property) (string, bool) {
+	c := int(math.Pow(float64(2), float64(r.b.inputCount)))
+	for i := 0; i < c; i++ {
+		mask := inputMask(i, r.b.inputCount)
+		r.setInputs(mask)
+		r.setState(state)
+		r.run()
+		if r.eval(p.root) == 1 {
+			return mask, true
+		}
+	}
+	return "", false
+}
+
+// GoalCount returns how many goals there are, one for each line of the goal
+func (b *Bench) GoalCount() int {
+	return len(b.goals)
+}
+
+// A GoalResult is what we found out about one of the goals
+type GoalResult struct {
+	Name string
+	Goal string
+
+	Reached bool
+	// The steps to the goal, in the same format as Solution, if it was reached
+	Trace string
+}
+
+// CheckGoals explicitly searches for all of the goals at once, exploring
+// the state space a single time and stopping once every goal has been
+// reached. Each result has the trace to the first state found that meets
+// its goal.
+func (b *Bench) CheckGoals() []GoalResult {
+	first := make([]string, len(b.goals))
+	reached := make([]bool, len(b.goals))
+	left := len(b.goals)
+	nextStates := b.reachableStates(func(state string) bool {
+		for i, g := range b.goals {
+			if !reached[i] && b.matches(g, state) {
+				reached[i], first[i] = true, state
+				left--
+			}
+		}
+		return left == 0
+	})
+
+	prevStates := previousStates(nextStates)
+	results := make([]GoalResult, len(b.goals))
+	for i, g := range b.goals {
+		results[i] = GoalResult{Name: g.name, Goal: g.src, Reached: reached[i]}
+		if reached[i] {
+			results[i].Trace = b.trace(prevStates, first[i], g)
+		}
+	}
+	return results
+}
+
+// SatGoals checks each of the goals with the SAT solver. The unrolled
+// circuit is only built once, and each goal's clauses are added to it in
+// turn.
+func (b *Bench) SatGoals() []GoalResult {
+	transitions := b.transitionClauses()
+	offset := b.portCount() * (b.Unroll - 1)
+	results := make([]GoalResult, len(b.goals))
+	for i, g := range b.goals {
+		clauses := addClauses(transitions[:len(transitions):len(transitions)], b.goalClauses(g, offset))
+		sat, out := runPicosat(clauses)
+		results[i] = GoalResult{Name: g.name, Goal: g.src, Reached: sat}
+		if sat {
+			results[i].Trace = b.parseOutput(out, g)
+		}
+	}
+	return results
+}
+
+// Report formats the results with one line per goal, followed by the trace
+// to it if it was reached
+func Report(results []GoalResult) string {
+	var buf bytes.Buffer
+	for _, r := range results {
+		status := "not reached"
+		if r.Reached {
+			status = "reached"
+		}
+		buf.WriteString(fmt.Sprint(r.Name, " (", r.Goal, "): ", status, "\n"))
+		for _, line := range strings.Split(strings.TrimSpace(r.Trace), "\n") {
+			if line != "" {
+				buf.WriteString("  " + line + "\n")
+			}
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,147 @@
+package bench
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// The kinds of problems we can run into flattening subcircuits, on top of the
+// ones checkLines looks for
+var (
+	ErrUnknownPort         = errors.New("subcircuit has no such port")
+	ErrRecursiveSubcircuit = errors.New("subcircuit instantiates itself")
+)
+
+// A subcircuit is defined between SUBCKT(name) and ENDS lines, with INPUT
+// and OUTPUT lines for its ports:
+//
+//	SUBCKT(toggle)
+//	INPUT(en)
+//	OUTPUT(q)
+//	q = DFF(d)
+//	d = XOR(q, en)
+//	ENDS
+//
+// and used with an instance line that connects its ports to nets by name:
+//
+//	u1 = toggle(en = A, q = Q1)
+//
+// Every net inside an instance gets the instance name as a prefix, like
+// u1.d, and its ports are connected with buffers, so u1.en = BUFF(A) and
+// Q1 = BUFF(u1.q).
+type subckt struct {
+	name    string
+	inputs  map[string]bool
+	outputs map[string]bool
+	body    []fileLine
+}
+
+type flattener struct {
+	filename string
+	subckts  map[string]*subckt
+	lines    []fileLine
+}
+
+func (f *flattener) lineErr(line fileLine, err error) error {
+	return &ParseError{File: f.filename, Line: line.num, Text: line.text, Err: err}
+}
+
+// Pulls the subcircuit definitions out of the lines, and replaces each
+// instance with the lines of its subcircuit
+func flatten(filename string, lines []fileLine) ([]fileLine, error) {
+	f := &flattener{filename: filename, subckts: make(map[string]*subckt)}
+
+	var top []fileLine
+	var current *subckt
+	for _, line := range lines {
+		switch {
+		case line.gateType == "SUBCKT":
+			if current != nil {
+				return nil, f.lineErr(line, fmt.Errorf("%w: SUBCKT inside of %s", ErrSyntax, current.name))
+			}
+			if _, ok := f.subckts[line.output]; ok {
+				return nil, f.lineErr(line, fmt.Errorf("%w: %s is defined twice", ErrSyntax, line.output))
+			}
+			current = &subckt{name: line.output, inputs: make(map[string]bool), outputs: make(map[string]bool)}
+			f.subckts[current.name] = current
+		case line.gateType == "ENDS":
+			if current == nil {
+				return nil, f.lineErr(line, fmt.Errorf("%w: ENDS without SUBCKT", ErrSyntax))
+			}
+			current = nil
+		case current == nil:
+			top = append(top, line)
+		case line.gateType == "INPUT":
+			current.inputs[line.output] = true
+		case line.gateType == "OUTPUT":
+			current.outputs[line.output] = true
+		default:
+			current.body = append(current.body, line)
+		}
+	}
+	if current != nil {
+		return nil, &ParseError{File: filename, Line: len(lines), Text: "SUBCKT(" + current.name + ")", Err: fmt.Errorf("%w: missing ENDS", ErrSyntax)}
+	}
+
+	// Nothing to do if there aren't any subcircuits
+	if len(f.subckts) == 0 {
+		return lines, nil
+	}
+	if err := f.expand("", top, nil); err != nil {
+		return nil, err
+	}
+	return f.lines, nil
+}
+
+// Adds the lines to the flattened circuit, with prefix in front of every
+// net, expanding any instances. The stack holds the subcircuits we're inside
+// of, to catch ones that contain themselves.
+func (f *flattener) expand(prefix string, lines []fileLine, stack []string) error {
+	rename := func(net string) string {
+		return prefix + net
+	}
+
+	for _, line := range lines {
+		if line.conns == nil {
+			out := line
+			out.output = rename(line.output)
+			out.inputs = make([]string, len(line.inputs))
+			for i, in := range line.inputs {
+				out.inputs[i] = rename(in)
+			}
+			f.lines = append(f.lines, out)
+			continue
+		}
+
+		s, ok := f.subckts[line.gateType]
+		if !ok {
+			return f.lineErr(line, ErrUnknownGate)
+		}
+		for _, name := range stack {
+			if name == s.name {
+				return f.lineErr(line, fmt.Errorf("%w: %s -> %s", ErrRecursiveSubcircuit, strings.Join(stack, " -> "), s.name))
+			}
+		}
+
+		inner := rename(line.output) + "."
+		buff := func(out, in string) {
+			fl := fileLine{output: out, inputs: []string{in}, gateType: "BUFF", num: line.num, text: line.text}
+			f.lines = append(f.lines, fl)
+		}
+		for _, conn := range line.conns {
+			switch {
+			case s.inputs[conn[0]]:
+				buff(inner+conn[0], rename(conn[1]))
+			case s.outputs[conn[0]]:
+				buff(rename(conn[1]), inner+conn[0])
+			default:
+				return f.lineErr(line, fmt.Errorf("%w: %s.%s", ErrUnknownPort, s.name, conn[0]))
+			}
+		}
+		if err := f.expand(inner, s.body, append(stack, s.name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package bench
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A LUT is a gate defined by its truth table, written as a hex mask before
+// its inputs, like the ones ABC writes:
+//
+//	X = LUT 0x8 (A, B)
+//
+// Bit i of the mask is the output when the inputs spell out i, with the
+// first input as the lowest bit, so 0x8 is a two-input AND and 0x6 is XOR.
+// The whole table has to fit in 64 bits.
+const maxLUTInputs = 6
+
+// Reads a mask like 0x8 or 0xcafe
+func parseMask(mask string) (uint64, error) {
+	if !strings.HasPrefix(mask, "0x") && !strings.HasPrefix(mask, "0X") {
+		return 0, errors.New("mask needs a 0x prefix")
+	}
+	return strconv.ParseUint(mask[2:], 16, 64)
+}
+
+// A product term over a LUT's inputs, holding the value of each input in
+// care that it depends on
+type cube struct {
+	care, value uint
+}
+
+// Whether the combination of inputs i is in the cube
+func (c cube) covers(i uint) bool {
+	return i&c.care == c.value
+}
+
+// Finds a small set of cubes covering every row of the truth table where
+// the output is on. We merge rows into prime implicants the Quine-McCluskey
+// way, then greedily pick the primes that cover the most rows that are left,
+// which is plenty for a table of 64 rows.
+func lutCover(mask uint64, n int, on bool) []cube {
+	all := uint(1)<<uint(n) - 1
+	var rows []uint
+	for i := uint(0); i <= all; i++ {
+		if (mask>>i&1 == 1) == on {
+			rows = append(rows, i)
+		}
+	}
+
+	var primes []cube
+	level := make(map[cube]bool)
+	for _, i := range rows {
+		level[cube{care: all, value: i}] = true
+	}
+	for len(level) > 0 {
+		next := make(map[cube]bool)
+		merged := make(map[cube]bool)
+		for a := range level {
+			for bit := uint(1); bit <= all; bit <<= 1 {
+				if a.care&bit == 0 || a.value&bit != 0 {
+					continue
+				}
+				b := cube{care: a.care, value: a.value | bit}
+				if level[b] {
+					next[cube{care: a.care &^ bit, value: a.value}] = true
+					merged[a], merged[b] = true, true
+				}
+			}
+		}
+		for c := range level {
+			if !merged[c] {
+				primes = append(primes, c)
+			}
+		}
+		level = next
+	}
+	// Map iteration order is random, and the clauses shouldn't be
+	sort.Slice(primes, func(i, j int) bool {
+		if primes[i].care != primes[j].care {
+			return primes[i].care < primes[j].care
+		}
+		return primes[i].value < primes[j].value
+	})
+
+	covered := make(map[uint]bool)
+	var cover []cube
+	for len(covered) < len(rows) {
+		best, bestCount := 0, 0
+		for i, c := range primes {
+			count := 0
+			for _, r := range rows {
+				if !covered[r] && c.covers(r) {
+					count++
+				}
+			}
+			if count > bestCount {
+				best, bestCount = i, count
+			}
+		}
+		for _, r := range rows {
+			if primes[best].covers(r) {
+				covered[r] = true
+			}
+		}
+		cover = append(cover, primes[best])
+	}
+	return cover
+}
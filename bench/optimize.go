@@ -0,0 +1,393 @@
+package bench
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+)
+
+// ErrNotEquivalent is returned by CheckEquivalent when two circuits disagree
+var ErrNotEquivalent = errors.New("circuits are not equivalent")
+
+// OptimizeReport says how much smaller Optimize made a circuit
+type OptimizeReport struct {
+	Before, After Stats
+}
+
+// The number of gates that aren't inputs or flip flops
+func combinationalGates(s Stats) int {
+	n := 0
+	for t, c := range s.Gates {
+		if !flipFlops[t] {
+			n += c
+		}
+	}
+	return n
+}
+
+func (r OptimizeReport) String() string {
+	var buf bytes.Buffer
+	before, after := combinationalGates(r.Before), combinationalGates(r.After)
+	fmt.Fprintf(&buf, "Gates: %d -> %d (%d removed)\n", before, after, before-after)
+	fmt.Fprintf(&buf, "Logic levels: %d -> %d\n", r.Before.Depth, r.After.Depth)
+	fmt.Fprintf(&buf, "CNF per unrolling: %d -> %d variables, %d -> %d clauses\n", r.Before.CNFVars, r.After.CNFVars, r.Before.CNFClauses, r.After.CNFClauses)
+	return buf.String()
+}
+
+// Optimize rebuilds the circuit as an and-inverter graph, which merges
+// duplicate gates, folds away constants and double inversions, and drops
+// logic that nothing looks at. The inputs, flip flops and outputs keep their
+// names and order, as do the nets the goals read, so the goals and traces
+// mean the same thing. The logic in between is written back out with the
+// simplest gates that fit the AIG. Wide XORs, LUTs and flip flops with an
+// enable, reset or set can take several ANDs each, so if the result isn't
+// any smaller, the circuit itself is returned.
+func (b *Bench) Optimize() (*Bench, OptimizeReport, error) {
+	g, lits := b.toAIG()
+	names := b.gateNames()
+
+	// The nets that have to keep their names, besides inputs and flip flops
+	var kept []string
+	seen := make(map[string]bool)
+	keep := func(name string) {
+		id := b.gateOutputs[name]
+		if !seen[name] && !b.gateType[id].input && !b.gateType[id].ff {
+			seen[name] = true
+			kept = append(kept, name)
+		}
+	}
+	for _, out := range b.outputs {
+		keep(out)
+	}
+	for _, id := range b.allGoalGates() {
+		keep(names[id])
+	}
+
+	roots := append([]int{}, g.next...)
+	for _, name := range kept {
+		roots = append(roots, lits[b.gateOutputs[name]])
+	}
+
+	w := newAIGWriter(g, roots)
+	for _, name := range names {
+		w.used[name] = true
+	}
+	for i, id := range b.inputs {
+		w.names[g.input(i)] = names[id]
+		w.defined[g.input(i)] = true
+	}
+	for i, id := range b.ffs {
+		w.names[g.latch(i)] = names[id]
+		w.defined[g.latch(i)] = true
+	}
+	// Kept nets name the gate that drives them if they can, rather than
+	// needing a buffer
+	for _, name := range kept {
+		lit := lits[b.gateOutputs[name]]
+		if _, ok := w.names[lit]; !ok && lit > 1 {
+			w.names[lit] = name
+		}
+	}
+
+	for _, id := range b.inputs {
+		w.lines = append(w.lines, fileLine{output: names[id], gateType: "INPUT", isIO: true})
+	}
+	for _, out := range b.outputs {
+		w.lines = append(w.lines, fileLine{output: out, gateType: "OUTPUT", isIO: true})
+	}
+	w.writeANDs()
+	for i, id := range b.ffs {
+		w.lines = append(w.lines, fileLine{output: names[id], inputs: []string{w.name(g.next[i])}, gateType: "DFF"})
+	}
+	for _, name := range kept {
+		if in := w.name(lits[b.gateOutputs[name]]); in != name {
+			w.lines = append(w.lines, fileLine{output: name, inputs: []string{in}, gateType: "BUFF"})
+		}
+	}
+	for i := range w.lines {
+		w.lines[i].text = w.lines[i].String()
+	}
+
+	opts := []Option{WithRunners(b.RunnerCount), WithUnroll(b.Unroll), WithLogLevel(b.LogLevel), WithName(b.name), WithInit(b.initPatterns()...)}
+	opt := newBench(b.Goal, opts)
+	opt.lines = w.lines
+	opt.namedTraces = b.namedTraces
+	if err := opt.load(); err != nil {
+		return nil, OptimizeReport{}, err
+	}
+	report := OptimizeReport{Before: b.Stats(), After: opt.Stats()}
+	if combinationalGates(report.After) >= combinationalGates(report.Before) && report.After.CNFClauses >= report.Before.CNFClauses {
+		return b, OptimizeReport{Before: report.Before, After: report.Before}, nil
+	}
+	return opt, report, nil
+}
+
+// Turns the ANDs of an AIG back into gates, adding NOT gates and constants
+// as they're needed. An AND whose inverse is all that's used becomes a NAND,
+// one of two inverted literals becomes a NOR or an OR, and the OR of two ANDs
+// that pick between two literals with a select line becomes a MUX or XOR.
+type aigWriter struct {
+	g     *aig
+	names map[int]string
+	used  map[string]bool
+	lines []fileLine
+
+	// The literals that have a gate driving them, or are inputs or latches
+	defined map[int]bool
+
+	// How many times each literal is read, by the ANDs that are live and by
+	// the roots
+	refs []int
+}
+
+func newAIGWriter(g *aig, roots []int) *aigWriter {
+	w := &aigWriter{g: g, names: make(map[int]string), used: make(map[string]bool), defined: make(map[int]bool), refs: make([]int, 2*(g.maxVar()+1))}
+	for _, lit := range roots {
+		w.refs[lit]++
+	}
+	// Each AND only reads earlier variables, so one pass from the top finds
+	// every one that's live
+	for v := g.maxVar(); v > g.nInputs+g.nLatches; v-- {
+		if w.uses(v) > 0 {
+			and := w.and(v)
+			w.refs[and[0]]++
+			w.refs[and[1]]++
+		}
+	}
+	return w
+}
+
+// The inputs of the AND for a variable
+func (w *aigWriter) and(v int) [2]int {
+	return w.g.ands[v-w.g.nInputs-w.g.nLatches-1]
+}
+
+func (w *aigWriter) isAND(lit int) bool {
+	return lit/2 > w.g.nInputs+w.g.nLatches
+}
+
+// How many times either polarity of a variable is read
+func (w *aigWriter) uses(v int) int {
+	return w.refs[2*v] + w.refs[2*v+1]
+}
+
+func (w *aigWriter) unique(name string) string {
+	for w.used[name] {
+		name += "_"
+	}
+	w.used[name] = true
+	return name
+}
+
+// The name of the net with the value of the literal, which has either been
+// written already or is the inverse of one that has
+func (w *aigWriter) name(lit int) string {
+	if w.defined[lit] {
+		return w.names[lit]
+	}
+	if lit < 2 {
+		if _, ok := w.names[lit]; !ok {
+			w.names[lit] = w.unique("const" + strconv.Itoa(lit))
+		}
+		w.lines = append(w.lines, fileLine{output: w.names[lit], gateType: "CONST" + strconv.Itoa(lit)})
+		w.defined[lit] = true
+		return w.names[lit]
+	}
+	inv := w.name(negate(lit))
+	if _, ok := w.names[lit]; !ok {
+		w.names[lit] = w.unique(inv + "_n")
+	}
+	w.lines = append(w.lines, fileLine{output: w.names[lit], inputs: []string{inv}, gateType: "NOT"})
+	w.defined[lit] = true
+	return w.names[lit]
+}
+
+// The name for the output of a gate we're about to write
+func (w *aigWriter) label(lit int) string {
+	if name, ok := w.names[lit]; ok {
+		return name
+	}
+	name := "n" + strconv.Itoa(lit/2)
+	if lit%2 == 1 {
+		name += "_n"
+	}
+	w.names[lit] = w.unique(name)
+	return w.names[lit]
+}
+
+func (w *aigWriter) gate(lit int, gateType string, ins ...int) {
+	names := make([]string, len(ins))
+	for i, in := range ins {
+		names[i] = w.name(in)
+	}
+	w.lines = append(w.lines, fileLine{output: w.label(lit), inputs: names, gateType: gateType})
+	w.defined[lit] = true
+}
+
+// Looks for an AND of two inverted ANDs that are only read here, like
+// !(s & a) & !(!s & b), returning the select line and the literals it picks
+// when it's on and off
+func (w *aigWriter) mux(v int) (sel, on, off int, ok bool) {
+	and := w.and(v)
+	x, y := negate(and[0]), negate(and[1])
+	if and[0]%2 == 0 || and[1]%2 == 0 || !w.isAND(x) || !w.isAND(y) || w.uses(x/2) != 1 || w.uses(y/2) != 1 {
+		return 0, 0, 0, false
+	}
+	a, b := w.and(x/2), w.and(y/2)
+	for i := 0; i < 2; i++ {
+		for j := 0; j < 2; j++ {
+			if a[i] == negate(b[j]) {
+				// The one without the inversion is the select line
+				if a[i]%2 == 0 {
+					return a[i], a[1-i], b[1-j], true
+				}
+				return b[j], b[1-j], a[1-i], true
+			}
+		}
+	}
+	return 0, 0, 0, false
+}
+
+func (w *aigWriter) writeANDs() {
+	first := w.g.nInputs + w.g.nLatches + 1
+
+	// MUXes are found from the top down, since the ANDs they swallow come
+	// before them
+	type mux struct{ sel, on, off int }
+	muxes := make(map[int]mux)
+	skip := make(map[int]bool)
+	for v := w.g.maxVar(); v >= first; v-- {
+		if w.uses(v) == 0 || skip[v] || w.refs[2*v] != 0 {
+			continue
+		}
+		if sel, on, off, ok := w.mux(v); ok {
+			muxes[v] = mux{sel, on, off}
+			and := w.and(v)
+			skip[and[0]/2], skip[and[1]/2] = true, true
+		}
+	}
+
+	for v := first; v <= w.g.maxVar(); v++ {
+		if w.uses(v) == 0 || skip[v] {
+			continue
+		}
+		pos, neg := 2*v, 2*v+1
+		x, y := w.and(v)[0], w.and(v)[1]
+
+		if m, ok := muxes[v]; ok {
+			switch {
+			case m.on == negate(m.off) && m.off%2 == 0:
+				w.gate(neg, "XOR", m.sel, m.off)
+			case m.on == negate(m.off):
+				w.gate(neg, "XNOR", m.sel, m.on)
+			default:
+				w.gate(neg, "MUX", m.sel, m.off, m.on)
+			}
+			continue
+		}
+
+		// We write whichever polarity is read more, as whichever gate needs
+		// the fewest NOTs in front of it
+		out, forms := pos, [2]string{"AND", "NOR"}
+		if w.refs[neg] > w.refs[pos] {
+			out, forms = neg, [2]string{"NAND", "OR"}
+		}
+		if w.missing(negate(x))+w.missing(negate(y)) < w.missing(x)+w.missing(y) {
+			w.gate(out, forms[1], negate(x), negate(y))
+		} else {
+			w.gate(out, forms[0], x, y)
+		}
+	}
+}
+
+// Whether a literal needs a gate written for it before it can be read
+func (w *aigWriter) missing(lit int) int {
+	if w.defined[lit] {
+		return 0
+	}
+	return 1
+}
+
+// CheckEquivalent makes sure the two circuits compute the same thing from
+// the same state: each flip flop takes the same value next, and each output,
+// along with every net the goals of b read, has the same value. The circuits
+// need the same inputs and flip flops, in the same order, like Optimize and
+// Reduce leave them. Every combination of inputs and flip flop values is
+// tried when there are up to 2^20 of them, and a random sample of that many
+// otherwise.
+func (b *Bench) CheckEquivalent(other *Bench) error {
+	if len(b.inputs) != len(other.inputs) || len(b.ffs) != len(other.ffs) {
+		return fmt.Errorf("%w: %d inputs and %d flip flops, compared to %d and %d", ErrNotEquivalent, len(b.inputs), len(b.ffs), len(other.inputs), len(other.ffs))
+	}
+
+	var nets []string
+	seen := make(map[string]bool)
+	names := b.gateNames()
+	for _, id := range b.allGoalGates() {
+		if !seen[names[id]] {
+			seen[names[id]] = true
+			nets = append(nets, names[id])
+		}
+	}
+	for _, out := range b.outputs {
+		if !seen[out] {
+			seen[out] = true
+			nets = append(nets, out)
+		}
+	}
+	for _, net := range nets {
+		if _, ok := other.gateOutputs[net]; !ok {
+			return fmt.Errorf("%w: %s is missing", ErrNotEquivalent, net)
+		}
+	}
+
+	const maxBits = 20
+	n := len(b.inputs) + len(b.ffs)
+	count := 1 << uint(maxBits)
+	exhaustive := n <= maxBits
+	if exhaustive {
+		count = 1 << uint(n)
+	}
+	rng := rand.New(rand.NewSource(1))
+	bits := make([]byte, n)
+	for i := 0; i < count; i++ {
+		for j := range bits {
+			on := i&(1<<uint(j)) != 0
+			if !exhaustive {
+				on = rng.Intn(2) == 1
+			}
+			bits[j] = '0'
+			if on {
+				bits[j] = '1'
+			}
+		}
+		input, state := string(bits[:len(b.inputs)]), string(bits[len(b.inputs):])
+
+		next, values := b.step(state, input, nets)
+		otherNext, otherValues := other.step(state, input, nets)
+		if next != otherNext {
+			return fmt.Errorf("%w: state %s with inputs %s goes to %s or %s", ErrNotEquivalent, state, input, next, otherNext)
+		}
+		for j, net := range nets {
+			if values[j] != otherValues[j] {
+				return fmt.Errorf("%w: %s differs in state %s with inputs %s", ErrNotEquivalent, net, state, input)
+			}
+		}
+	}
+	return nil
+}
+
+// Runs a single step, giving the next state and the values of the nets
+func (b *Bench) step(state, input string, nets []string) (string, []bool) {
+	r := b.runners[0]
+	r.setInputs(input)
+	r.setState(state)
+	r.run()
+	values := make([]bool, len(nets))
+	for i, net := range nets {
+		values[i] = r.outState[b.gateOutputs[net]].on
+	}
+	return r.State(), values
+}
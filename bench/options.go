@@ -0,0 +1,51 @@
+package bench
+
+// An Option configures a Bench as it's being built
+type Option func(*Bench)
+
+// WithRunners sets the number of runner threads used for explicit search
+func WithRunners(n int) Option {
+	return func(b *Bench) {
+		b.RunnerCount = n
+	}
+}
+
+// WithUnroll sets the number of unrollings used for symbolic search
+func WithUnroll(n int) Option {
+	return func(b *Bench) {
+		b.Unroll = n
+	}
+}
+
+// WithLogLevel sets how much information is printed, one of None, Debug or
+// Verbose
+func WithLogLevel(level int) Option {
+	return func(b *Bench) {
+		b.LogLevel = level
+	}
+}
+
+// WithName sets the name used to refer to the netlist in error messages
+func WithName(name string) Option {
+	return func(b *Bench) {
+		b.name = name
+	}
+}
+
+// WithInit sets the states the circuit can start in, with a 0, 1, or X (or -)
+// for don't care, for each flip flop. This takes the place of any initial
+// values given in the netlist.
+func WithInit(states ...string) Option {
+	return func(b *Bench) {
+		b.init = append([]string(nil), states...)
+	}
+}
+
+// WithNamedTraces prints each step of a trace as the values of the named
+// flip flops and inputs, with the bits of a bus like cnt[0], cnt[1], etc.
+// grouped together as cnt[3:0], instead of as strings of bits
+func WithNamedTraces() Option {
+	return func(b *Bench) {
+		b.namedTraces = true
+	}
+}
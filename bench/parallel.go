@@ -0,0 +1,150 @@
+package bench
+
+// The number of input combinations simulated at once, one per bit of a word
+const lanes = 64
+
+// The patterns of the low six bits of a counter across the 64 lanes, where
+// lane j counts j. The bit 1<<k of lane j is the bit j of lowBits[k].
+var lowBits = [6]uint64{
+	0xaaaaaaaaaaaaaaaa,
+	0xcccccccccccccccc,
+	0xf0f0f0f0f0f0f0f0,
+	0xff00ff00ff00ff00,
+	0xffff0000ffff0000,
+	0xffffffff00000000,
+}
+
+// A wordSim runs 64 combinations of inputs through the circuit at once,
+// with each gate's value for all of them packed into a word. Each pass runs
+// the circuit's program a single time.
+type wordSim struct {
+	b *Bench
+
+	// The value of each gate, a bit for each lane, indexed by gate ID
+	values []uint64
+}
+
+func newWordSim(b *Bench) *wordSim {
+	return &wordSim{b: b, values: make([]uint64, len(b.toInputs))}
+}
+
+// Puts every lane in the same state
+func (s *wordSim) setState(state string) {
+	for i, bit := range state {
+		s.values[s.b.ffs[i]] = fill(bit == '1')
+	}
+}
+
+// Gives lane j the inputs from inputMask(first+j, ...), where first is a
+// multiple of 64
+func (s *wordSim) setInputs(first int) {
+	n := len(s.b.inputs)
+	for i, id := range s.b.inputs {
+		// The first input is the most significant bit of the mask
+		bit := uint(n - 1 - i)
+		if bit < uint(len(lowBits)) {
+			s.values[id] = lowBits[bit]
+		} else {
+			s.values[id] = fill(first>>bit&1 == 1)
+		}
+	}
+}
+
+func fill(on bool) uint64 {
+	if on {
+		return ^uint64(0)
+	}
+	return 0
+}
+
+// Run through a single step of the circuit in every lane
+func (s *wordSim) run() {
+	program := s.b.program
+	for i := range program {
+		s.values[program[i].out] = s.exec(&program[i])
+	}
+}
+
+func (s *wordSim) exec(in *instr) uint64 {
+	v := s.values
+	var out uint64
+	switch in.op {
+	case opAND:
+		out = ^uint64(0)
+		for _, id := range in.ins {
+			out &= v[id]
+		}
+	case opOR:
+		for _, id := range in.ins {
+			out |= v[id]
+		}
+	case opXOR:
+		for _, id := range in.ins {
+			out ^= v[id]
+		}
+	case opBUFF:
+		out = v[in.ins[0]]
+	case opMUX:
+		out = v[in.ins[0]]&v[in.ins[2]] | ^v[in.ins[0]]&v[in.ins[1]]
+	case opLUT:
+		out = s.execLUT(in)
+	}
+	if in.invert {
+		return ^out
+	}
+	return out
+}
+
+// Ors together the rows of the truth table that are on, each of which is on
+// in the lanes where the inputs spell out that row
+func (s *wordSim) execLUT(in *instr) uint64 {
+	var out uint64
+	for row := uint(0); row < 1<<uint(len(in.ins)); row++ {
+		if in.mask>>row&1 == 0 {
+			continue
+		}
+		term := ^uint64(0)
+		for i, id := range in.ins {
+			if row>>uint(i)&1 == 1 {
+				term &= s.values[id]
+			} else {
+				term &^= s.values[id]
+			}
+		}
+		out |= term
+	}
+	return out
+}
+
+// The value each flip flop takes on the next clock edge, in every lane
+func (s *wordSim) nextValue(g int) uint64 {
+	ins := s.b.toInputs[g]
+	d := s.values[ins[0]]
+	switch gt := s.b.gateType[g]; {
+	case gt.enable:
+		en := s.values[ins[1]]
+		return d&en | s.values[g]&^en
+	case gt.reset:
+		return d &^ s.values[ins[1]]
+	case gt.set:
+		return d | s.values[ins[1]]
+	}
+	return d
+}
+
+// The next state of each of the first n lanes
+func (s *wordSim) states(n int) []string {
+	nFFs := len(s.b.ffs)
+	buf := make([]byte, n*nFFs)
+	for i, id := range s.b.ffs {
+		next := s.nextValue(id)
+		for lane := 0; lane < n; lane++ {
+			buf[lane*nFFs+i] = byte('0' + next>>uint(lane)&1)
+		}
+	}
+	states := make([]string, n)
+	for lane := range states {
+		states[lane] = string(buf[lane*nFFs : (lane+1)*nFFs])
+	}
+	return states
+}
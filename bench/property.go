@@ -0,0 +1,458 @@
+package bench
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The kinds of problems ParseProperty and CheckProperty can find
+var (
+	ErrPropertySyntax = errors.New("malformed property")
+	ErrPropertyType   = errors.New("ill-typed property")
+)
+
+// A Property is a Boolean condition on the nets of a circuit, like
+// "err | (req & !ack)" or "cnt[3:0] == 4'b1010 -> done". From loosest to
+// tightest binding, the operators are:
+//
+//	a -> b    a implies b, grouping to the right
+//	a | b     either one
+//	a & b     both
+//	a == b    the same value, for bits or vectors of the same width
+//	a != b    different values
+//	!a        the opposite of a
+//
+// A name on its own is a net, or a whole bus when the circuit has nets named
+// like cnt[0], cnt[1], etc. A bus can be sliced with cnt[hi:lo], and
+// compared to a number, which can be given with a width, like 4'b1010, 4'hA
+// or 4'd10.
+type Property struct {
+	src  string
+	root *propExpr
+}
+
+func (p *Property) String() string {
+	return p.src
+}
+
+// A node in the syntax tree of a property
+type propExpr struct {
+	op   string
+	args []*propExpr
+	pos  int
+
+	// For names and slices
+	name   string
+	hi, lo int
+	slice  bool
+
+	// For numbers, with a width of 0 when none was given
+	value uint64
+	width int
+
+	// Filled in by the type checker: the gate ID of each bit of a name or
+	// slice, most significant first, and whether the value is a vector
+	ids    []int
+	vector bool
+}
+
+// The width of the value an expression has, once it's been checked
+func (e *propExpr) bits() int {
+	if e.op == "num" {
+		return e.width
+	}
+	if e.vector {
+		return len(e.ids)
+	}
+	return 1
+}
+
+type propToken struct {
+	text string
+	pos  int
+}
+
+var (
+	propNameRE   = regexp.MustCompile(`^[\w.$]+`)
+	propIndexRE  = regexp.MustCompile(`^\[(\d+)\]`)
+	propSliceRE  = regexp.MustCompile(`^\[(\d+):(\d+)\]`)
+	propNumberRE = regexp.MustCompile(`^(\d+)'([bdh])([0-9a-fA-F_]+)`)
+)
+
+// Splits a property up into operators, parentheses, names and numbers.
+// Names keep their single bit indexes, like cnt[3], but slices like
+// cnt[3:0] are split off as a separate token.
+func lexProperty(src string) ([]propToken, error) {
+	var tokens []propToken
+	for i := 0; i < len(src); {
+		rest := src[i:]
+		switch {
+		case rest[0] == ' ' || rest[0] == '\t':
+			i++
+			continue
+		case strings.HasPrefix(rest, "->"), strings.HasPrefix(rest, "=="), strings.HasPrefix(rest, "!="):
+			tokens = append(tokens, propToken{rest[:2], i})
+			i += 2
+			continue
+		case strings.ContainsRune("!&|()", rune(rest[0])):
+			tokens = append(tokens, propToken{rest[:1], i})
+			i++
+			continue
+		}
+
+		if m := propNumberRE.FindString(rest); m != "" {
+			tokens = append(tokens, propToken{m, i})
+			i += len(m)
+			continue
+		}
+
+		name := propNameRE.FindString(rest)
+		if name == "" {
+			return nil, fmt.Errorf("%w: unexpected %q at column %d", ErrPropertySyntax, rest[:1], i+1)
+		}
+		start := i
+		i += len(name)
+		for {
+			if m := propNameRE.FindString(src[i:]); m != "" {
+				i += len(m)
+			} else if m := propIndexRE.FindString(src[i:]); m != "" {
+				i += len(m)
+			} else {
+				break
+			}
+		}
+		tokens = append(tokens, propToken{src[start:i], start})
+		if m := propSliceRE.FindString(src[i:]); m != "" {
+			tokens = append(tokens, propToken{m, i})
+			i += len(m)
+		}
+	}
+	return tokens, nil
+}
+
+type propParser struct {
+	tokens []propToken
+	i      int
+	end    int
+}
+
+func (p *propParser) peek() string {
+	if p.i < len(p.tokens) {
+		return p.tokens[p.i].text
+	}
+	return ""
+}
+
+func (p *propParser) pos() int {
+	if p.i < len(p.tokens) {
+		return p.tokens[p.i].pos
+	}
+	return p.end
+}
+
+func (p *propParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s at column %d", ErrPropertySyntax, fmt.Sprintf(format, args...), p.pos()+1)
+}
+
+// ParseProperty parses a property, without checking that the nets it uses
+// exist or that its types line up. CheckProperty does that for a circuit.
+func ParseProperty(src string) (*Property, error) {
+	tokens, err := lexProperty(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &propParser{tokens: tokens, end: len(src)}
+	root, err := p.implies()
+	if err != nil {
+		return nil, err
+	}
+	if p.i < len(p.tokens) {
+		return nil, p.errorf("unexpected %q", p.peek())
+	}
+	return &Property{src: strings.TrimSpace(src), root: root}, nil
+}
+
+func (p *propParser) implies() (*propExpr, error) {
+	left, err := p.binary(0)
+	if err != nil || p.peek() != "->" {
+		return left, err
+	}
+	pos := p.pos()
+	p.i++
+	right, err := p.implies()
+	if err != nil {
+		return nil, err
+	}
+	return &propExpr{op: "->", args: []*propExpr{left, right}, pos: pos}, nil
+}
+
+// The binary operators that group to the left, from loosest to tightest
+var propLevels = [][]string{{"|"}, {"&"}, {"==", "!="}}
+
+func (p *propParser) binary(level int) (*propExpr, error) {
+	if level == len(propLevels) {
+		return p.unary()
+	}
+	left, err := p.binary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		found := false
+		for _, o := range propLevels[level] {
+			found = found || o == op
+		}
+		if !found {
+			return left, nil
+		}
+		pos := p.pos()
+		p.i++
+		right, err := p.binary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = &propExpr{op: op, args: []*propExpr{left, right}, pos: pos}
+	}
+}
+
+func (p *propParser) unary() (*propExpr, error) {
+	pos := p.pos()
+	switch tok := p.peek(); {
+	case tok == "!":
+		p.i++
+		arg, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &propExpr{op: "!", args: []*propExpr{arg}, pos: pos}, nil
+	case tok == "(":
+		p.i++
+		e, err := p.implies()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, p.errorf("expected )")
+		}
+		p.i++
+		return e, nil
+	case tok == "":
+		return nil, p.errorf("unexpected end")
+	case propNumberRE.MatchString(tok):
+		p.i++
+		return parseSizedNumber(tok, pos)
+	case propNameRE.MatchString(tok):
+		p.i++
+		e := &propExpr{op: "name", name: tok, pos: pos}
+		if m := propSliceRE.FindStringSubmatch(p.peek()); m != nil {
+			p.i++
+			e.slice = true
+			e.hi, _ = strconv.Atoi(m[1])
+			e.lo, _ = strconv.Atoi(m[2])
+		}
+		return e, nil
+	}
+	return nil, p.errorf("unexpected %q", p.peek())
+}
+
+// Parses a number with a width, in binary, decimal or hex
+func parseSizedNumber(tok string, pos int) (*propExpr, error) {
+	m := propNumberRE.FindStringSubmatch(tok)
+	width, err := strconv.Atoi(m[1])
+	if err != nil || width < 1 || width > 64 {
+		return nil, fmt.Errorf("%w: bad width in %s at column %d", ErrPropertySyntax, tok, pos+1)
+	}
+	base := map[string]int{"b": 2, "d": 10, "h": 16}[m[2]]
+	value, err := strconv.ParseUint(strings.Replace(m[3], "_", "", -1), base, 64)
+	if err != nil || (width < 64 && value>>uint(width) != 0) {
+		return nil, fmt.Errorf("%w: %s doesn't fit at column %d", ErrPropertySyntax, tok, pos+1)
+	}
+	return &propExpr{op: "num", value: value, width: width, pos: pos}, nil
+}
+
+// The nets named like name[3], grouped by name, with the gate ID of each bit
+func (b *Bench) netGroups() map[string]map[int]int {
+	groups := make(map[string]map[int]int)
+	for name, id := range b.gateOutputs {
+		bus, bit, ok := busBit(name)
+		if !ok {
+			continue
+		}
+		if groups[bus] == nil {
+			groups[bus] = make(map[int]int)
+		}
+		groups[bus][bit] = id
+	}
+	return groups
+}
+
+// CheckProperty makes sure every name in the property is a net or a bus of
+// the circuit, and that every operator gets values of the right type. Only
+// a single bit can be used as a condition, so vectors have to be compared to
+// something.
+func (b *Bench) CheckProperty(p *Property) error {
+	c := &propChecker{b: b, groups: b.netGroups()}
+	if err := c.check(p.root); err != nil {
+		return err
+	}
+	return c.condition(p.root)
+}
+
+type propChecker struct {
+	b      *Bench
+	groups map[string]map[int]int
+}
+
+func (c *propChecker) errorf(e *propExpr, format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s at column %d", ErrPropertyType, fmt.Sprintf(format, args...), e.pos+1)
+}
+
+// Makes sure an expression is a single bit, turning a plain 0 or 1 into a
+// constant bit
+func (c *propChecker) condition(e *propExpr) error {
+	if e.op == "num" {
+		if e.width > 1 || e.value > 1 {
+			return c.errorf(e, "%d is not a single bit", e.value)
+		}
+		e.width = 1
+		return nil
+	}
+	if e.vector {
+		return c.errorf(e, "%s is a %d bit vector, not a single bit", e.name, len(e.ids))
+	}
+	return nil
+}
+
+func (c *propChecker) check(e *propExpr) error {
+	for _, arg := range e.args {
+		if err := c.check(arg); err != nil {
+			return err
+		}
+	}
+
+	switch e.op {
+	case "name":
+		return c.resolve(e)
+	case "!", "&", "|", "->":
+		for _, arg := range e.args {
+			if err := c.condition(arg); err != nil {
+				return err
+			}
+		}
+	case "==", "!=":
+		l, r := e.args[0], e.args[1]
+		switch {
+		case l.op == "num" && r.op == "num":
+			return c.errorf(e, "comparing two numbers")
+		case l.op == "num":
+			return c.fits(l, r)
+		case r.op == "num":
+			return c.fits(r, l)
+		case l.bits() != r.bits():
+			return c.errorf(e, "comparing %d bits to %d bits", l.bits(), r.bits())
+		}
+	}
+	return nil
+}
+
+// Makes sure a number fits in the width of what it's compared to, giving it
+// that width
+func (c *propChecker) fits(num, e *propExpr) error {
+	if num.width == 0 && e.bits() < 64 && num.value>>uint(e.bits()) != 0 {
+		return c.errorf(num, "%d doesn't fit in %d bits", num.value, e.bits())
+	}
+	if num.width != 0 && num.width != e.bits() {
+		return c.errorf(num, "comparing %d bits to %d bits", num.width, e.bits())
+	}
+	num.width = e.bits()
+	return nil
+}
+
+// Looks up the nets a name or slice refers to. A name made of nothing but
+// digits is a number, unless there's a net with that name.
+func (c *propChecker) resolve(e *propExpr) error {
+	if id, ok := c.b.gateOutputs[e.name]; ok && !e.slice {
+		e.ids = []int{id}
+		return nil
+	}
+
+	group, ok := c.groups[e.name]
+	if !ok {
+		if v, err := strconv.ParseUint(e.name, 10, 64); err == nil && !e.slice {
+			e.op, e.value = "num", v
+			return nil
+		}
+		return c.errorf(e, "no net or bus named %s", e.name)
+	}
+
+	if !e.slice {
+		var bits []int
+		for bit := range group {
+			bits = append(bits, bit)
+		}
+		sort.Ints(bits)
+		e.hi, e.lo = bits[len(bits)-1], bits[0]
+	}
+	step := 1
+	if e.hi > e.lo {
+		step = -1
+	}
+	for bit := e.hi; ; bit += step {
+		id, ok := group[bit]
+		if !ok {
+			return c.errorf(e, "%s has no bit %d", e.name, bit)
+		}
+		e.ids = append(e.ids, id)
+		if bit == e.lo {
+			break
+		}
+	}
+	if len(e.ids) > 64 {
+		return c.errorf(e, "%s is wider than 64 bits", e.name)
+	}
+	e.vector = true
+	return nil
+}
+
+// Evaluates a checked expression with the values from the last run,
+// returning the value of a bit or vector
+func (r *runner) eval(e *propExpr) uint64 {
+	switch e.op {
+	case "num":
+		return e.value
+	case "name":
+		var v uint64
+		for _, id := range e.ids {
+			v <<= 1
+			if r.outState[id].on {
+				v |= 1
+			}
+		}
+		return v
+	case "!":
+		return r.eval(e.args[0]) ^ 1
+	case "&":
+		return r.eval(e.args[0]) & r.eval(e.args[1])
+	case "|":
+		return r.eval(e.args[0]) | r.eval(e.args[1])
+	case "->":
+		return (r.eval(e.args[0]) ^ 1) | r.eval(e.args[1])
+	case "==":
+		return boolBit(r.eval(e.args[0]) == r.eval(e.args[1]))
+	case "!=":
+		return boolBit(r.eval(e.args[0]) != r.eval(e.args[1]))
+	}
+	return 0
+}
+
+func boolBit(on bool) uint64 {
+	if on {
+		return 1
+	}
+	return 0
+}
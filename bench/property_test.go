@@ -0,0 +1,236 @@
+package bench
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// A two bit counter that counts while en is on, with the count on a bus
+var counterBus = `INPUT(en)
+OUTPUT(wrap)
+cnt[0] = DFF(n0)
+cnt[1] = DFF(n1)
+n0 = XOR(cnt[0], en)
+c0 = AND(cnt[0], en)
+n1 = XOR(cnt[1], c0)
+wrap = AND(c0, cnt[1])
+`
+
+func TestProperty(t *testing.T) {
+	bench := loadTestBench(t, counterBus, "")
+
+	tests := []struct {
+		src string
+		// Whether it holds in each state, for some input
+		holds map[string]bool
+		err   error
+	}{
+		{src: "wrap", holds: map[string]bool{"11": true, "01": false, "10": false}},
+		{src: "cnt == 2", holds: map[string]bool{"01": true, "10": false}},
+		{src: "cnt[1:0] == 2'b01", holds: map[string]bool{"10": true, "01": false}},
+		{src: "cnt[0:1] == 2'b01", holds: map[string]bool{"01": true, "10": false}},
+		{src: "cnt[1] & !en", holds: map[string]bool{"01": true, "11": true, "10": false}},
+		{src: "en -> wrap", holds: map[string]bool{"00": true}},
+		{src: "!(en | cnt[0]) & cnt != 0", holds: map[string]bool{"01": true, "11": false, "00": false}},
+		{src: "wrap == (cnt == 3)", holds: map[string]bool{"11": true}},
+		{src: "cnt[1] == 1 & 1", holds: map[string]bool{"01": true, "00": false}},
+		{src: "cnt", err: ErrPropertyType},
+		{src: "cnt == 4", err: ErrPropertyType},
+		{src: "cnt == 3'b100", err: ErrPropertyType},
+		{src: "cnt[2:0] == 0", err: ErrPropertyType},
+		{src: "cnt & en", err: ErrPropertyType},
+		{src: "2", err: ErrPropertyType},
+		{src: "1 == 1", err: ErrPropertyType},
+		{src: "missing", err: ErrPropertyType},
+		{src: "(wrap", err: ErrPropertySyntax},
+		{src: "wrap en", err: ErrPropertySyntax},
+		{src: "wrap ^ en", err: ErrPropertySyntax},
+		{src: "cnt == 2'b111", err: ErrPropertySyntax},
+		{src: "", err: ErrPropertySyntax},
+	}
+	for _, test := range tests {
+		p, err := ParseProperty(test.src)
+		if err == nil {
+			err = bench.CheckProperty(p)
+		}
+		if !errors.Is(err, test.err) {
+			t.Errorf("%q: Expected %v, Got %v", test.src, test.err, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		for state, holds := range test.holds {
+			if _, ok := bench.runners[0].satisfyingInputs(state, p); ok != holds {
+				t.Errorf("%q in %s: Expected %t, Got %t", test.src, state, holds, ok)
+			}
+		}
+		checkPropertyClauses(t, bench, p)
+	}
+
+	// An input that no gate reads can still be named
+	bench = loadTestBench(t, "INPUT(spare)\n"+counterBus, "spare & !cnt[0]")
+	checkPropertyClauses(t, bench, bench.goals[0].prop)
+}
+
+// Checks that the clauses for a property can be satisfied exactly when the
+// property holds, for every combination of inputs and flip flops
+func checkPropertyClauses(t *testing.T, bench *Bench, p *Property) {
+	first := bench.portCount()
+	clauses := bench.propertyClauses(p, 0, first)
+	last := first
+	for _, c := range clauses {
+		for _, term := range c.Terms {
+			if abs(term) > last {
+				last = abs(term)
+			}
+		}
+	}
+
+	r := bench.runners[0]
+	names := bench.gateNames()
+	nIn, nFF := len(bench.inputs), len(bench.ffs)
+	for i := 0; i < 1<<uint(nIn+nFF); i++ {
+		input := fmt.Sprintf("%0*b", nIn+nFF, i)
+		r.setInputs(input[:nIn])
+		r.setState(input[nIn:])
+		r.run()
+
+		values := make([]bool, last+1)
+		for id, name := range names {
+			values[bench.portMap[name]] = r.outState[id].on
+		}
+		found := false
+		for j := 0; j < 1<<uint(last-first) && !found; j++ {
+			for k := first + 1; k <= last; k++ {
+				values[k] = j&(1<<uint(k-first-1)) != 0
+			}
+			found = satisfies(clauses, values)
+		}
+		if holds := r.eval(p.root) == 1; found != holds {
+			t.Errorf("%q with %s: Expected the clauses to be satisfiable %t, Got %t", p, input, holds, found)
+		}
+	}
+}
+
+func TestMultipleGoals(t *testing.T) {
+	goals := "wrap\nthree: cnt == 3\n\nnever: cnt[0] & !cnt[0]\n11\n"
+	bench := loadTestBench(t, counterBus, goals)
+	if n := bench.GoalCount(); n != 4 {
+		t.Fatalf("Expected 4 goals, Got %d", n)
+	}
+
+	results := bench.CheckGoals()
+	want := []struct {
+		name, goal string
+		reached    bool
+		final      string
+	}{
+		{"p0", "wrap", true, "Final: 11 Inputs: 1"},
+		{"three", "cnt == 3", true, "Final: 11 Inputs: 0"},
+		{"never", "cnt[0] & !cnt[0]", false, ""},
+		{"p3", "11", true, "Final: 11"},
+	}
+	for i, w := range want {
+		r := results[i]
+		if r.Name != w.name || r.Goal != w.goal || r.Reached != w.reached {
+			t.Errorf("Expected %s (%s) reached %t, Got %s (%s) reached %t", w.name, w.goal, w.reached, r.Name, r.Goal, r.Reached)
+		}
+		lines := strings.Split(strings.TrimSpace(r.Trace), "\n")
+		if w.reached && (!strings.HasPrefix(lines[0], "Initial: 00") || lines[len(lines)-1] != w.final) {
+			t.Errorf("%s: Expected a trace from 00 ending in %q, Got:\n%s", w.name, w.final, r.Trace)
+		}
+	}
+
+	report := Report(results)
+	if !strings.Contains(report, "never (cnt[0] & !cnt[0]): not reached\n") || !strings.Contains(report, "three (cnt == 3): reached\n  Initial: 00") {
+		t.Errorf("Unexpected report:\n%s", report)
+	}
+}
+
+// The SAT trace to a goal should be the same length as the explicit one when
+// there are as many unrollings as steps, for properties as well as states
+func TestSatTrace(t *testing.T) {
+	for _, goal := range []string{"cnt == 2 & en", "01"} {
+		bench := loadTestBench(t, counterBus, goal)
+		ok, states := bench.IsReachable()
+		if !ok {
+			t.Fatalf("%s: Expected the goal to be reachable", goal)
+		}
+		explicit := bench.Solution(states)
+
+		// Each line of the trace is a state, and maybe the inputs after it
+		var steps []State
+		for _, line := range strings.Split(strings.TrimSpace(explicit), "\n") {
+			fields := strings.Fields(line)
+			if fields[len(fields)-2] == "Inputs:" {
+				steps = append(steps, State{state: fields[len(fields)-3], input: fields[len(fields)-1]})
+			} else {
+				steps = append(steps, State{state: fields[len(fields)-1]})
+			}
+		}
+		bench.Unroll = len(steps) - 1
+
+		// The values the solver would give the ports, from simulating the trace
+		names := bench.gateNames()
+		values := make(map[int]bool)
+		simulate := func(step State, offset int) {
+			r := bench.runners[0]
+			r.setInputs(step.input)
+			r.setState(step.state)
+			r.run()
+			for id, name := range names {
+				values[bench.portMap[name]+offset] = r.outState[id].on
+			}
+		}
+		for i, step := range steps[:bench.Unroll] {
+			simulate(step, bench.portCount()*i)
+		}
+		first := bench.portCount() * bench.Unroll
+		if final := steps[bench.Unroll]; final.input != "" {
+			simulate(final, bench.propertyOffset())
+			first = bench.propertyOffset() + bench.portCount()
+		}
+
+		// Then whatever the property's own variables need to be
+		clauses := addClauses(bench.transitionClauses(), bench.endClauses(bench.portCount()*(bench.Unroll-1)))
+		last := first
+		for _, c := range clauses {
+			for _, term := range c.Terms {
+				if abs(term) > last {
+					last = abs(term)
+				}
+			}
+		}
+		assignment := make([]bool, last+1)
+		found := false
+		for j := 0; j < 1<<uint(last-first) && !found; j++ {
+			for k := 1; k <= last; k++ {
+				assignment[k] = values[k]
+				if k > first {
+					assignment[k] = j&(1<<uint(k-first-1)) != 0
+				}
+			}
+			found = satisfies(clauses, assignment)
+		}
+		if !found {
+			t.Errorf("%s: Expected the clauses to allow the explicit trace", goal)
+			continue
+		}
+
+		out := "s SATISFIABLE\nv"
+		for k := 1; k <= last; k++ {
+			if assignment[k] {
+				out += " " + strconv.Itoa(k)
+			} else {
+				out += " -" + strconv.Itoa(k)
+			}
+		}
+		if sat := bench.parseOutput(out+" 0\n", bench.firstGoal()); sat != explicit {
+			t.Errorf("%s: Expected the SAT trace to match the explicit one:\n%sGot:\n%s", goal, explicit, sat)
+		}
+	}
+}
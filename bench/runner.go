@@ -17,8 +17,11 @@ type runner struct {
 }
 
 type outState struct {
-	ready bool
-	on    bool
+	on bool
+
+	// In ternary simulation, whether the value isn't known, in which case on
+	// is false
+	unknown bool
 }
 
 func (r *runner) State() string {
@@ -27,9 +30,12 @@ func (r *runner) State() string {
 	buffer := bytes.NewBuffer(buf)
 
 	for _, id := range r.b.ffs {
-		if r.outState[r.b.toInputs[id][0]].on {
+		switch next := r.nextValue(id); {
+		case next.unknown:
+			buffer.WriteString("X")
+		case next.on:
 			buffer.WriteString("1")
-		} else {
+		default:
 			buffer.WriteString("0")
 		}
 	}
@@ -39,6 +45,7 @@ func (r *runner) State() string {
 
 // Reads in states from inState channel, writes a list of what states you can reach in 1-step to foundStates
 func (r *runner) reachableFromState(inStates <-chan string, foundStates chan<- newState, searched chan<- bool) {
+	sim := newWordSim(r.b)
 	for state := range inStates {
 		r.b.debugStatement(fmt.Sprint("Runner ", r.id, " checking ", state), Debug)
 		// If there are n inputs, there are 2^n combinations of those inputs
@@ -47,21 +54,22 @@ func (r *runner) reachableFromState(inStates <-chan string, foundStates chan<- n
 		// Keep track of the states we've found from here
 		found := make(map[string]bool)
 
-		for i := 0; i < c; i++ {
-			// A bit mask padded with zeroes
-			mask := fmt.Sprintf("%0"+strconv.Itoa(r.b.inputCount)+"b", i)
-			r.clearState()
-			r.setInputs(mask)
-			r.setState(state)
-			// Run the circuit
-			r.run()
-			// nextState is the state we've reached by running our sim
-			nextState := r.State()
-			// If we haven't seen this nextState yet
-			if _, ok := found[nextState]; !ok {
-				found[nextState] = true
-				foundStates <- newState{state, State{nextState, mask}}
-				r.b.debugStatement(fmt.Sprint("Runner ", r.id, " found ", nextState), Debug)
+		sim.setState(state)
+		// Try the inputs 64 at a time
+		for first := 0; first < c; first += lanes {
+			n := c - first
+			if n > lanes {
+				n = lanes
+			}
+			sim.setInputs(first)
+			sim.run()
+			for lane, nextState := range sim.states(n) {
+				// If we haven't seen this nextState yet
+				if _, ok := found[nextState]; !ok {
+					found[nextState] = true
+					foundStates <- newState{state, State{nextState, inputMask(first+lane, r.b.inputCount)}}
+					r.b.debugStatement(fmt.Sprint("Runner ", r.id, " found ", nextState), Debug)
+				}
 			}
 		}
 		// Prevents a race condition between the foundStates and searched channels
@@ -75,106 +83,121 @@ func (r *runner) reachableFromState(inStates <-chan string, foundStates chan<- n
 	r.b.debugStatement(fmt.Sprint("Runner ", r.id, " finishing"), Debug)
 }
 
-// Run through a single step of the circuit
+// Run through a single step of the circuit, once the inputs and flip flops
+// are set
 func (r *runner) run() {
-	b := r.b
-	gatesToCheck := []int{}
-	gateCheck := make([]bool, b.gateCount+b.inputCount)
-	// Our inputs are all ready
-	for _, in := range b.inputs {
-		r.outState[in].ready = true
-		for _, id := range b.toOutputs[in] {
-			if !b.gateType[id].ff && !gateCheck[id] {
-				if r.inputsReady(id) {
-					gateCheck[id] = true
-					gatesToCheck = append(gatesToCheck, id)
-				}
-			}
-		}
-	}
-
-	// Our state gates are all ready
-	for _, g := range b.ffs {
-		r.outState[g].ready = true
-		for _, id := range b.toOutputs[g] {
-			if !b.gateType[id].ff && !gateCheck[id] {
-				if r.inputsReady(id) {
-					gateCheck[id] = true
-					gatesToCheck = append(gatesToCheck, id)
-				}
-			}
-		}
+	program := r.b.program
+	for i := range program {
+		r.outState[program[i].out] = outState{on: r.exec(&program[i])}
 	}
+}
 
-	for {
-		// Pop off the gate
-		var gate int
-		gate, gatesToCheck = gatesToCheck[0], gatesToCheck[1:]
-		var on bool
-		if b.gateType[gate].and {
-			on = r.isOnAND(gate)
-		} else if b.gateType[gate].not {
-			on = r.isOnNOT(gate)
-		}
-		out := r.outState[gate]
-
-		out.on = on
-		out.ready = true
-		r.outState[gate] = out
-		for _, id := range b.toOutputs[gate] {
-			// If  we have a new gate that hasn't been checked
-			if !b.gateType[id].ff && !gateCheck[id] {
-				if r.inputsReady(id) {
-					gateCheck[id] = true
-					gatesToCheck = append(gatesToCheck, id)
-				}
-			}
-		}
-		if len(gatesToCheck) == 0 {
-			break
-		}
+func (r *runner) exec(in *instr) bool {
+	var on bool
+	switch in.op {
+	case opAND:
+		on = r.isOnAND(in.ins)
+	case opOR:
+		on = r.isOnOR(in.ins)
+	case opXOR:
+		on = r.isOnXOR(in.ins)
+	case opBUFF:
+		on = r.isOnBUFF(in.ins)
+	case opMUX:
+		on = r.isOnMUX(in.ins)
+	case opLUT:
+		on = r.isOnLUT(in.mask, in.ins)
 	}
+	return on != in.invert
 }
 
-func (r *runner) setInputs(mask string) {
-	for i, bit := range mask {
-		r.outState[r.b.inputs[i]].on = bit == '1'
+// The bits of i, padded with zeroes to one bit per input. Without any inputs
+// there's only the empty mask.
+func inputMask(i, nInputs int) string {
+	if nInputs == 0 {
+		return ""
 	}
+	return fmt.Sprintf("%0"+strconv.Itoa(nInputs)+"b", i)
 }
 
-func (r *runner) clearState() {
-	for i := range r.outState {
-		r.outState[i].ready = false
+// Sets the inputs, where an X or - is an input whose value isn't known
+func (r *runner) setInputs(mask string) {
+	for i := range mask {
+		r.outState[r.b.inputs[i]] = outState{on: mask[i] == '1', unknown: isDontCare(mask[i])}
 	}
 }
 
+// Sets the flip flops, where an X or - is a flip flop whose value isn't known
 func (r *runner) setState(mask string) {
-	for i, bit := range mask {
-		r.outState[r.b.ffs[i]].on = bit == '1'
+	for i := range mask {
+		r.outState[r.b.ffs[i]] = outState{on: mask[i] == '1', unknown: isDontCare(mask[i])}
 	}
 }
 
-func (r *runner) inputsReady(g int) bool {
-	for _, in := range r.b.toInputs[g] {
-		// in is the id of the gate who's output is connected to one of g's inputs
-		if !r.outState[in].ready {
+func (r *runner) isOnAND(ins []int) bool {
+	for _, in := range ins {
+		// in is the id of the gate who's output is connected to one of the inputs
+		if !r.outState[in].on {
 			return false
 		}
 	}
 	return true
 }
 
-func (r *runner) isOnAND(g int) bool {
-	for _, in := range r.b.toInputs[g] {
-		// in is the id of the gate who's output is connected to one of g's inputs
-		if !r.outState[in].on {
-			return false
+func (r *runner) isOnOR(ins []int) bool {
+	for _, in := range ins {
+		if r.outState[in].on {
+			return true
 		}
 	}
-	return true
+	return false
+}
+
+func (r *runner) isOnXOR(ins []int) bool {
+	// XOR is on when an odd number of its inputs are on
+	on := false
+	for _, in := range ins {
+		if r.outState[in].on {
+			on = !on
+		}
+	}
+	return on
+}
+
+func (r *runner) isOnBUFF(ins []int) bool {
+	return r.outState[ins[0]].on
 }
 
-func (r *runner) isOnNOT(g int) bool {
-	in := r.b.toInputs[g][0]
-	return !r.outState[in].on
+// The value a flip flop takes on the next clock edge, which is unknown when
+// it depends on something unknown
+func (r *runner) nextValue(g int) outState {
+	ins := r.b.toInputs[g]
+	d := r.outState[ins[0]]
+	switch gt := r.b.gateType[g]; {
+	case gt.enable:
+		return mux(r.outState[ins[1]], r.outState[g], d)
+	case gt.reset:
+		return d.and(r.outState[ins[1]].not())
+	case gt.set:
+		return d.or(r.outState[ins[1]])
+	}
+	return d
+}
+
+func (r *runner) isOnMUX(ins []int) bool {
+	if r.outState[ins[0]].on {
+		return r.outState[ins[2]].on
+	}
+	return r.outState[ins[1]].on
+}
+
+// A LUT looks up the row of its truth table that its inputs spell out
+func (r *runner) isOnLUT(mask uint64, ins []int) bool {
+	var row uint
+	for i, in := range ins {
+		if r.outState[in].on {
+			row |= 1 << uint(i)
+		}
+	}
+	return mask>>row&1 == 1
 }
@@ -35,8 +35,18 @@ func (c *Clause) string() string {
 }
 
 func (b *Bench) Sat() (bool, string) {
+	sat, out := runPicosat(b.asSat())
+	if !sat {
+		return false, ""
+	}
+	return true, b.parseOutput(out, b.firstGoal())
+}
+
+// Runs picosat on the clauses, returning whether they can be satisfied and
+// the solver's output
+func runPicosat(clauses []Clause) (bool, string) {
 	cmd := exec.Command("picosat")
-	cmd.Stdin = strings.NewReader(b.SatString())
+	cmd.Stdin = strings.NewReader(cnfString(clauses))
 	var out bytes.Buffer
 	cmd.Stdout = &out
 	err := cmd.Run()
@@ -44,7 +54,7 @@ func (b *Bench) Sat() (bool, string) {
 		if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
 			stat := status.ExitStatus()
 			if stat == 10 { // Satisfiable
-				return true, b.parseOutput(out.String())
+				return true, out.String()
 			} else if stat == 20 { // Unsatisfiable
 				return false, ""
 			}
@@ -54,88 +64,114 @@ func (b *Bench) Sat() (bool, string) {
 	return false, ""
 }
 
-func (b *Bench) parseOutput(out string) string {
-	// SatMap maps from ids to gate names, for more verbose output
-	relevantIDs := make(map[int]gateType)
-	inputState := make([]string, b.Unroll)
-	gateState := make([]string, b.Unroll+1) // The plus 1 accounts for initial state
-
-	for _, line := range b.lines {
-		if line.gateType == "INPUT" {
-			id := b.portMap[line.output]
-			gt := relevantIDs[id]
-			gt.input = true
-			relevantIDs[id] = gt
-		} else if line.gateType == "DFF" {
-			id := b.portMap[line.inputs[0]]
-			gt := relevantIDs[id]
-			gt.ff = true
-			relevantIDs[id] = gt
-
-			id = b.portMap[line.output]
-			gt = relevantIDs[id]
-			gt.initial = true
-			relevantIDs[id] = gt
+// Reads the trace to the goal out of the values picosat gave each variable
+func (b *Bench) parseOutput(out string, g *goal) string {
+	values := make(map[int]bool)
+	// The first line says whether it's satisfiable, and the rest start with v
+	for _, line := range strings.Split(out, "\n")[1:] {
+		for _, s := range strings.Fields(line) {
+			if n, err := strconv.Atoi(s); err == nil {
+				values[abs(n)] = n > 0
+			}
 		}
 	}
 
-	portCount := len(b.portMap)
-	// First we remove the first line, which deals with satisfiability
-	res := strings.Split(out, "\n")[1:]
-	for _, line := range res {
-		// Then we remove the leading 'v'
-		sp := strings.Split(line, " ")[1:]
-		for _, s := range sp {
-			n, _ := strconv.Atoi(s)
-
-			originalID := ((abs(n) - 1) % portCount) + 1
-			unrolling := ((abs(n) - 1) / portCount)
-
-			if gt, ok := relevantIDs[originalID]; ok {
-				bit := "0"
-				if n > 0 {
-					bit = "1"
-				}
-
-				if gt.input {
-					inputState[unrolling] += bit
-				}
-
-				if gt.ff {
-					gateState[unrolling+1] += bit
-				}
-
-				// The ID check makes sure that it's the first unrolling
-				if gt.initial && abs(n) == originalID {
-					gateState[unrolling] += bit
-				}
+	bits := func(ids []int, port func(id int) int, offset int) string {
+		buf := make([]byte, len(ids))
+		for i, id := range ids {
+			buf[i] = '0'
+			if values[port(id)+offset] {
+				buf[i] = '1'
 			}
 		}
+		return string(buf)
 	}
-	var buf bytes.Buffer
-	for i := range gateState {
-		if i == 0 {
-			buf.WriteString(fmt.Sprint("Initial: ", gateState[i], " Inputs: ", inputState[i], "\n"))
-		} else if i < len(gateState)-1 {
-			buf.WriteString(fmt.Sprint("State ", i+1, ": ", gateState[i], " Inputs: ", inputState[i], "\n"))
-		} else {
-			buf.WriteString(fmt.Sprint("Final: ", gateState[i], "\n"))
-		}
+	outPort := func(id int) int { return b.ports[id].output }
+
+	portCount := b.portCount()
+	steps := make([]State, b.Unroll)
+	for i := range steps {
+		steps[i] = State{state: bits(b.ffs, outPort, portCount*i), input: bits(b.inputs, outPort, portCount*i)}
 	}
-	return buf.String()
+	final := State{state: bits(b.ffs, b.nextPort, portCount*(b.Unroll-1))}
+	// For properties, we also need the inputs that make it true
+	withInputs := g != nil && g.prop != nil
+	if withInputs {
+		final.input = bits(b.inputs, outPort, b.propertyOffset())
+	}
+	return b.formatTrace(steps, final, withInputs)
 }
 
 type gateType struct {
-	input   bool
-	ff      bool
-	initial bool
-	and     bool
-	not     bool
+	input  bool
+	ff     bool
+	and    bool
+	or     bool
+	nand   bool
+	nor    bool
+	xor    bool
+	xnor   bool
+	not    bool
+	buff   bool
+	mux    bool
+	lut    bool
+	const0 bool
+	const1 bool
+
+	// Flip flops with an enable, a synchronous reset or a synchronous set
+	enable bool
+	reset  bool
+	set    bool
+}
+
+// The name of the gate type, as it appears in a bench file
+func (gt gateType) String() string {
+	switch {
+	case gt.input:
+		return "INPUT"
+	case gt.ff && gt.enable:
+		return "DFFE"
+	case gt.ff && gt.reset:
+		return "DFFR"
+	case gt.ff && gt.set:
+		return "DFFS"
+	case gt.ff:
+		return "DFF"
+	case gt.and:
+		return "AND"
+	case gt.or:
+		return "OR"
+	case gt.nand:
+		return "NAND"
+	case gt.nor:
+		return "NOR"
+	case gt.xor:
+		return "XOR"
+	case gt.xnor:
+		return "XNOR"
+	case gt.not:
+		return "NOT"
+	case gt.buff:
+		return "BUFF"
+	case gt.mux:
+		return "MUX"
+	case gt.lut:
+		return "LUT"
+	case gt.const0:
+		return "CONST0"
+	case gt.const1:
+		return "CONST1"
+	}
+	return "UNKNOWN"
 }
 
 func (b *Bench) SatString() string {
+	return cnfString(b.asSat())
+}
+
+// Formats clauses in the DIMACS format that SAT solvers take
+func cnfString(clauses []Clause) string {
 	var buf bytes.Buffer
-	clauses := b.asSat()
 	buf.WriteString(fmt.Sprintf("p cnf %d %d\n", varCount(clauses), expCount(clauses)))
 	for _, clause := range clauses {
 		buf.WriteString(clause.string() + "\n")
@@ -166,82 +202,259 @@ func expCount(clauses []Clause) int {
 }
 
 func (b *Bench) asSat() []Clause {
+	return addClauses(b.transitionClauses(), b.endClauses(b.portCount()*(b.Unroll-1)))
+}
+
+// The clauses for the initial states and every unrolling of the circuit,
+// which every goal is checked against
+func (b *Bench) transitionClauses() []Clause {
 	clauses := b.initClauses()
-	portCount := len(b.portMap)
+	portCount := b.portCount()
 	for i := 0; i < b.Unroll; i++ {
 		// The offset is the number of gates in each unrolling, times the cycle we're on
 		offset := portCount * i
 
 		// Add gates for each unrolling
 		clauses = addClauses(clauses, []Clause{commentClause("Unrolling number ", i+1)})
-		for id := range b.toOutputs {
-			// We don't set conditions on ports
-			if b.gateType[id].input {
-				continue
-			} else if b.gateType[id].and {
-				clauses = addClauses(clauses, b.andClauses(id, offset))
-			} else if b.gateType[id].not {
-				clauses = addClauses(clauses, b.notClauses(id, offset))
-			}
-		}
+		clauses = addClauses(clauses, b.gateClauses(offset))
 
 		// Add connection constraint between unrollings, except the last one
 		if i != b.Unroll-1 {
 			clauses = addClauses(clauses, []Clause{commentClause("Connections between unrolling number ", i+1, " and unrolling number ", i+2)})
-			for _, g := range b.ffs {
-				conn := make([]Clause, 2)
+			clauses = addClauses(clauses, b.connectClauses(offset, offset+portCount))
+		}
+	}
 
-				in := b.ports[g].inputs[0] + offset
-				out := b.ports[g].output + offset + portCount
+	return clauses
+}
 
-				conn[0].Terms = []int{in, -out}
-				conn[1].Terms = []int{-in, out}
-				clauses = addClauses(clauses, conn)
-			}
-		}
+// The clauses making the flip flops in the unrolling at to hold the values
+// they take next in the unrolling at from
+func (b *Bench) connectClauses(from, to int) []Clause {
+	var clauses []Clause
+	for _, g := range b.ffs {
+		conn := make([]Clause, 2)
+
+		in := b.nextPort(g) + from
+		out := b.ports[g].output + to
+
+		conn[0].Terms = []int{in, -out}
+		conn[1].Terms = []int{-in, out}
+		clauses = addClauses(clauses, conn)
 	}
+	return clauses
+}
 
-	clauses = addClauses(clauses, b.endClauses(portCount*(b.Unroll-1)))
+// The clauses describing every gate in a single unrolling
+func (b *Bench) gateClauses(offset int) []Clause {
+	var clauses []Clause
+	for id := range b.toOutputs {
+		// We don't set conditions on ports
+		if b.gateType[id].input {
+			continue
+		} else if b.gateType[id].ff {
+			clauses = addClauses(clauses, b.ffClauses(id, offset))
+		} else if b.gateType[id].and {
+			clauses = addClauses(clauses, b.andClauses(id, offset))
+		} else if b.gateType[id].or {
+			clauses = addClauses(clauses, b.orClauses(id, offset))
+		} else if b.gateType[id].nand {
+			clauses = addClauses(clauses, b.nandClauses(id, offset))
+		} else if b.gateType[id].nor {
+			clauses = addClauses(clauses, b.norClauses(id, offset))
+		} else if b.gateType[id].xor {
+			clauses = addClauses(clauses, b.xorClauses(id, offset))
+		} else if b.gateType[id].xnor {
+			clauses = addClauses(clauses, b.xnorClauses(id, offset))
+		} else if b.gateType[id].not {
+			clauses = addClauses(clauses, b.notClauses(id, offset))
+		} else if b.gateType[id].buff {
+			clauses = addClauses(clauses, b.buffClauses(id, offset))
+		} else if b.gateType[id].mux {
+			clauses = addClauses(clauses, b.muxClauses(id, offset))
+		} else if b.gateType[id].lut {
+			clauses = addClauses(clauses, b.lutClauses(id, offset))
+		} else if b.gateType[id].const0 || b.gateType[id].const1 {
+			clauses = addClauses(clauses, b.constClauses(id, offset))
+		}
+	}
 	return clauses
 }
 
+// The first unrolling starts in one of the initial states. A single initial
+// state is just a unit clause per flip flop, but with several of them each one
+// gets a selector variable, numbered after every unrolling, that forces its
+// bits when it's on, and at least one of the selectors has to be on.
 func (b *Bench) initClauses() []Clause {
-	nFF := len(b.ffs)
-	clauses := make([]Clause, nFF+1)
-	clauses[0] = commentClause("Initial conditions")
-	for i, g := range b.ffs {
-		clauses[i+1].Terms = []int{-b.ports[g].output}
+	clauses := []Clause{commentClause("Initial conditions")}
+	patterns := b.initPatterns()
+	selectors := make([]int, len(patterns))
+	if b.selectorCount() > 0 {
+		for i := range patterns {
+			selectors[i] = b.portCount()*b.Unroll + i + 1
+		}
+		clauses = append(clauses, Clause{Terms: selectors})
+	}
+
+	for i, pattern := range patterns {
+		for j, g := range b.ffs {
+			// Xs can start with either value
+			if pattern[j] == 'X' {
+				continue
+			}
+			literal := b.ports[g].output
+			if pattern[j] == '0' {
+				literal = -literal
+			}
+			if selectors[i] == 0 {
+				clauses = append(clauses, Clause{Terms: []int{literal}})
+			} else {
+				clauses = append(clauses, Clause{Terms: []int{-selectors[i], literal}})
+			}
+		}
 	}
 	return clauses
 }
 
+// The number of initial state selector variables, which is none when there's
+// only one initial state
+func (b *Bench) selectorCount() int {
+	if n := len(b.initPatterns()); n > 1 {
+		return n
+	}
+	return 0
+}
+
+// The offset of the copy of the gates a property is checked in
+func (b *Bench) propertyOffset() int {
+	return b.portCount()*b.Unroll + b.selectorCount()
+}
+
+// The clauses for the first goal, in the unrolling at offset
 func (b *Bench) endClauses(offset int) []Clause {
-	nFF := len(b.ffs)
-	clauses := make([]Clause, nFF+1)
-	clauses[0] = commentClause("Goal conditions")
-	for i, bit := range b.Goal {
-		literal := b.ports[b.ffs[i]].inputs[0] + offset
+	if len(b.goals) == 0 {
+		return []Clause{commentClause("Goal conditions")}
+	}
+	return b.goalClauses(b.goals[0], offset)
+}
+
+func (b *Bench) goalClauses(g *goal, offset int) []Clause {
+	clauses := []Clause{commentClause("Goal conditions for ", g.name)}
+	// A property has to hold, for some inputs, in the state the last
+	// unrolling ends in, the same one a state goal looks at. That takes one
+	// more copy of the gates, numbered after the selectors.
+	if g.prop != nil {
+		check := b.propertyOffset()
+		clauses = addClauses(clauses, b.gateClauses(check))
+		clauses = addClauses(clauses, b.connectClauses(offset, check))
+		return append(clauses, b.propertyClauses(g.prop, check, check+b.portCount())...)
+	}
+	for i := range g.state {
+		// Don't cares don't constrain anything
+		if isDontCare(g.state[i]) {
+			continue
+		}
+		literal := b.nextPort(b.ffs[i]) + offset
 
 		// Flip the bit if we want it off
-		if bit == '0' {
+		if g.state[i] == '0' {
 			literal = -literal
 		}
 
-		clauses[i+1].Terms = []int{literal}
+		clauses = append(clauses, Clause{Terms: []int{literal}})
 	}
 	return clauses
 }
 
 func (b *Bench) andClauses(id, offset int) []Clause {
-	clauses := make([]Clause, 3)
-	in1 := b.ports[id].inputs[0] + offset
-	in2 := b.ports[id].inputs[1] + offset
+	return b.andLikeClauses(id, offset, false)
+}
+
+func (b *Bench) nandClauses(id, offset int) []Clause {
+	return b.andLikeClauses(id, offset, true)
+}
+
+// OR is AND with its inputs and output inverted
+func (b *Bench) orClauses(id, offset int) []Clause {
+	clauses := b.andClauses(id, offset)
+	for _, c := range clauses {
+		for i := range c.Terms {
+			c.Terms[i] = -c.Terms[i]
+		}
+	}
+	return clauses
+}
+
+func (b *Bench) norClauses(id, offset int) []Clause {
+	clauses := b.nandClauses(id, offset)
+	for _, c := range clauses {
+		for i := range c.Terms {
+			c.Terms[i] = -c.Terms[i]
+		}
+	}
+	return clauses
+}
+
+// The output of an AND is implied by all of its inputs being on, and each
+// input being off implies the output is off. Inverting the output gives NAND
+func (b *Bench) andLikeClauses(id, offset int, invert bool) []Clause {
+	ins := b.ports[id].inputs
+	clauses := make([]Clause, len(ins)+1)
+	out := b.ports[id].output + offset
+	if invert {
+		out = -out
+	}
+
+	all := make([]int, 0, len(ins)+1)
+	for i, in := range ins {
+		clauses[i].Terms = []int{in + offset, -out}
+		all = append(all, -(in + offset))
+	}
+	clauses[len(ins)].Terms = append(all, out)
+
+	return clauses
+}
+
+func (b *Bench) xorClauses(id, offset int) []Clause {
+	return b.parityClauses(id, offset, false)
+}
+
+func (b *Bench) xnorClauses(id, offset int) []Clause {
+	return b.parityClauses(id, offset, true)
+}
+
+// Wide parity gates are chained together two inputs at a time, using the aux
+// ports allocated when the gate was added
+func (b *Bench) parityClauses(id, offset int, invert bool) []Clause {
+	ins := b.ports[id].inputs
 	out := b.ports[id].output + offset
+	if invert {
+		out = -out
+	}
+
+	if len(ins) == 1 {
+		return []Clause{{Terms: []int{-(ins[0] + offset), out}}, {Terms: []int{ins[0] + offset, -out}}}
+	}
 
-	clauses[0].Terms = []int{in1, -out}
-	clauses[1].Terms = []int{in2, -out}
-	clauses[2].Terms = []int{-in1, -in2, out}
+	var clauses []Clause
+	prev := ins[0] + offset
+	for i := 1; i < len(ins); i++ {
+		next := out
+		if i < len(ins)-1 {
+			next = b.ports[id].aux[i-1] + offset
+		}
+		clauses = addClauses(clauses, xor2Clauses(prev, ins[i]+offset, next))
+		prev = next
+	}
+	return clauses
+}
 
+func xor2Clauses(in1, in2, out int) []Clause {
+	clauses := make([]Clause, 4)
+	clauses[0].Terms = []int{-in1, -in2, -out}
+	clauses[1].Terms = []int{in1, in2, -out}
+	clauses[2].Terms = []int{in1, -in2, out}
+	clauses[3].Terms = []int{-in1, in2, out}
 	return clauses
 }
 
@@ -255,6 +468,103 @@ func (b *Bench) notClauses(id, offset int) []Clause {
 	return clauses
 }
 
+func (b *Bench) buffClauses(id, offset int) []Clause {
+	clauses := make([]Clause, 2)
+	in := b.ports[id].inputs[0] + offset
+	out := b.ports[id].output + offset
+
+	clauses[0].Terms = []int{-in, out}
+	clauses[1].Terms = []int{in, -out}
+	return clauses
+}
+
+// Whichever input the select line picks is equal to the output
+func (b *Bench) muxClauses(id, offset int) []Clause {
+	ins := b.ports[id].inputs
+	return muxTerms(ins[0]+offset, ins[1]+offset, ins[2]+offset, b.ports[id].output+offset)
+}
+
+func muxTerms(sel, in0, in1, out int) []Clause {
+	return []Clause{
+		{Terms: []int{sel, -in0, out}},
+		{Terms: []int{sel, in0, -out}},
+		{Terms: []int{-sel, -in1, out}},
+		{Terms: []int{-sel, in1, -out}},
+	}
+}
+
+// The port holding the value a flip flop takes next, which is its D input
+// unless it has an enable, reset or set
+func (b *Bench) nextPort(id int) int {
+	if len(b.ports[id].aux) > 0 {
+		return b.ports[id].aux[0]
+	}
+	return b.ports[id].inputs[0]
+}
+
+// A plain flip flop doesn't need any clauses within an unrolling, but the
+// others work out the value they take next from their inputs and their
+// current value
+func (b *Bench) ffClauses(id, offset int) []Clause {
+	gt := b.gateType[id]
+	if !gt.enable && !gt.reset && !gt.set {
+		return nil
+	}
+	ins := b.ports[id].inputs
+	d, ctl := ins[0]+offset, ins[1]+offset
+	q := b.ports[id].output + offset
+	next := b.nextPort(id) + offset
+
+	switch {
+	case gt.enable:
+		return muxTerms(ctl, q, d, next)
+	case gt.reset:
+		return []Clause{{Terms: []int{-next, d}}, {Terms: []int{-next, -ctl}}, {Terms: []int{next, -d, ctl}}}
+	default:
+		return []Clause{{Terms: []int{next, -d}}, {Terms: []int{next, -ctl}}, {Terms: []int{-next, d, ctl}}}
+	}
+}
+
+// Each cube covering the rows where the LUT is on forces the output on, and
+// each one covering the rows where it's off forces it off, so a LUT gets
+// about as many clauses as a sum of products for it has terms
+func (b *Bench) lutClauses(id, offset int) []Clause {
+	ins := b.ports[id].inputs
+	out := b.ports[id].output + offset
+
+	var clauses []Clause
+	for _, on := range []bool{true, false} {
+		lit := out
+		if !on {
+			lit = -out
+		}
+		for _, c := range lutCover(b.luts[id], len(ins), on) {
+			terms := []int{lit}
+			for i, in := range ins {
+				if c.care&(1<<uint(i)) == 0 {
+					continue
+				}
+				if c.value&(1<<uint(i)) != 0 {
+					terms = append(terms, -(in + offset))
+				} else {
+					terms = append(terms, in+offset)
+				}
+			}
+			clauses = append(clauses, Clause{Terms: terms})
+		}
+	}
+	return clauses
+}
+
+// A constant is a single unit clause
+func (b *Bench) constClauses(id, offset int) []Clause {
+	literal := b.ports[id].output + offset
+	if b.gateType[id].const0 {
+		literal = -literal
+	}
+	return []Clause{{Terms: []int{literal}}}
+}
+
 func addClauses(a, b []Clause) []Clause {
 	return append(a, b...)
 }
@@ -269,3 +579,112 @@ func abs(x int) int {
 	}
 	return x
 }
+
+// Encodes a property with the Tseitin encoding, where every operator gets a
+// new variable that's forced to have the operator's value. The nets come from
+// the unrolling at offset, the new variables are numbered after next, and the
+// last clause makes the property hold.
+func (b *Bench) propertyClauses(p *Property, offset, next int) []Clause {
+	enc := &propEncoder{b: b, offset: offset, next: next}
+	root := enc.encode(p.root)
+	return append(enc.clauses, Clause{Terms: []int{root}})
+}
+
+type propEncoder struct {
+	b      *Bench
+	offset int
+
+	// The last variable handed out, and the one that's always on, if we've
+	// needed it yet
+	next    int
+	trueVar int
+
+	clauses []Clause
+}
+
+func (enc *propEncoder) newVar() int {
+	enc.next++
+	return enc.next
+}
+
+func (enc *propEncoder) add(terms ...int) {
+	enc.clauses = append(enc.clauses, Clause{Terms: terms})
+}
+
+func (enc *propEncoder) constant(on bool) int {
+	if enc.trueVar == 0 {
+		enc.trueVar = enc.newVar()
+		enc.add(enc.trueVar)
+	}
+	if on {
+		return enc.trueVar
+	}
+	return -enc.trueVar
+}
+
+// The literals for each bit of a name or number, most significant first
+func (enc *propEncoder) bits(e *propExpr) []int {
+	var lits []int
+	switch e.op {
+	case "num":
+		for i := e.width - 1; i >= 0; i-- {
+			lits = append(lits, enc.constant(e.value>>uint(i)&1 == 1))
+		}
+	case "name":
+		for _, id := range e.ids {
+			lits = append(lits, enc.b.ports[id].output+enc.offset)
+		}
+	default:
+		lits = append(lits, enc.encode(e))
+	}
+	return lits
+}
+
+// Returns the literal with the value of a single bit expression
+func (enc *propEncoder) encode(e *propExpr) int {
+	switch e.op {
+	case "!":
+		return -enc.encode(e.args[0])
+	case "&":
+		return enc.and(enc.encode(e.args[0]), enc.encode(e.args[1]))
+	case "|":
+		return -enc.and(-enc.encode(e.args[0]), -enc.encode(e.args[1]))
+	case "->":
+		return -enc.and(enc.encode(e.args[0]), -enc.encode(e.args[1]))
+	case "==", "!=":
+		l, r := enc.bits(e.args[0]), enc.bits(e.args[1])
+		same := make([]int, len(l))
+		for i := range l {
+			same[i] = enc.xnor(l[i], r[i])
+		}
+		lit := enc.and(same...)
+		if e.op == "!=" {
+			return -lit
+		}
+		return lit
+	}
+	return enc.bits(e)[0]
+}
+
+func (enc *propEncoder) and(lits ...int) int {
+	if len(lits) == 1 {
+		return lits[0]
+	}
+	v := enc.newVar()
+	all := []int{v}
+	for _, lit := range lits {
+		enc.add(-v, lit)
+		all = append(all, -lit)
+	}
+	enc.add(all...)
+	return v
+}
+
+func (enc *propEncoder) xnor(a, b int) int {
+	v := enc.newVar()
+	enc.add(-v, -a, b)
+	enc.add(-v, a, -b)
+	enc.add(v, a, b)
+	enc.add(v, -a, -b)
+	return v
+}
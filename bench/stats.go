@@ -0,0 +1,203 @@
+package bench
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Stats describes the size and shape of a circuit, for sizing up a problem
+// before picking explicit or symbolic search
+type Stats struct {
+	// The number of gates of each type, like "AND" or "DFF"
+	Gates map[string]int
+
+	Inputs    int
+	Outputs   int
+	FlipFlops int
+
+	// The most gates on any path from an input, flip flop or constant to
+	// another gate
+	Depth int
+
+	// How many gate inputs each input and gate drives
+	MaxFanout int
+	AvgFanout float64
+
+	// The strongly connected components of the graph with an edge from one
+	// flip flop to another when the first one feeds the logic in front of
+	// the second
+	SCCs       int
+	LargestSCC int
+
+	// The size of the CNF for a single unrolling, including the connections
+	// to the next one
+	CNFVars    int
+	CNFClauses int
+}
+
+// Stats works out the statistics for the circuit
+func (b *Bench) Stats() Stats {
+	s := Stats{
+		Gates:     make(map[string]int),
+		Inputs:    len(b.inputs),
+		Outputs:   len(b.outputs),
+		FlipFlops: len(b.ffs),
+		CNFVars:   b.portCount(),
+	}
+
+	fanout := 0
+	for id, gt := range b.gateType {
+		if !gt.input {
+			s.Gates[gt.String()]++
+		}
+		fanout += len(b.toOutputs[id])
+		if len(b.toOutputs[id]) > s.MaxFanout {
+			s.MaxFanout = len(b.toOutputs[id])
+		}
+	}
+	if len(b.gateType) > 0 {
+		s.AvgFanout = float64(fanout) / float64(len(b.gateType))
+	}
+
+	level := make([]int, len(b.toInputs))
+	for _, id := range b.topoOrder() {
+		for _, in := range b.toInputs[id] {
+			if level[in] > level[id] {
+				level[id] = level[in]
+			}
+		}
+		level[id]++
+		if level[id] > s.Depth {
+			s.Depth = level[id]
+		}
+	}
+
+	for _, scc := range b.latchSCCs() {
+		s.SCCs++
+		if len(scc) > s.LargestSCC {
+			s.LargestSCC = len(scc)
+		}
+	}
+
+	for _, c := range b.gateClauses(0) {
+		if c.hasTerms() {
+			s.CNFClauses++
+		}
+	}
+	s.CNFClauses += 2 * len(b.ffs)
+	return s
+}
+
+// The flip flops whose values reach each flip flop's inputs through
+// combinational logic, indexed by position in b.ffs
+func (b *Bench) latchDeps() [][]int {
+	pos := make(map[int]int)
+	for i, id := range b.ffs {
+		pos[id] = i
+	}
+
+	deps := make([][]int, len(b.ffs))
+	for i, ff := range b.ffs {
+		seen := make(map[int]bool)
+		stack := append([]int{}, b.toInputs[ff]...)
+		for len(stack) > 0 {
+			id := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			if b.gateType[id].ff {
+				deps[i] = append(deps[i], pos[id])
+				continue
+			}
+			stack = append(stack, b.toInputs[id]...)
+		}
+	}
+	return deps
+}
+
+// Tarjan's algorithm over the latch dependency graph, giving each strongly
+// connected component as a list of positions in b.ffs
+func (b *Bench) latchSCCs() [][]int {
+	deps := b.latchDeps()
+	index := make([]int, len(deps))
+	low := make([]int, len(deps))
+	onStack := make([]bool, len(deps))
+	for i := range index {
+		index[i] = -1
+	}
+
+	var sccs [][]int
+	var stack []int
+	next := 0
+	var visit func(v int)
+	visit = func(v int) {
+		index[v], low[v] = next, next
+		next++
+		stack = append(stack, v)
+		onStack[v] = true
+		for _, w := range deps[v] {
+			if index[w] < 0 {
+				visit(w)
+				if low[w] < low[v] {
+					low[v] = low[w]
+				}
+			} else if onStack[w] && index[w] < low[v] {
+				low[v] = index[w]
+			}
+		}
+		if low[v] != index[v] {
+			return
+		}
+		var scc []int
+		for {
+			w := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[w] = false
+			scc = append(scc, w)
+			if w == v {
+				break
+			}
+		}
+		sccs = append(sccs, scc)
+	}
+	for v := range deps {
+		if index[v] < 0 {
+			visit(v)
+		}
+	}
+	return sccs
+}
+
+// SearchBits is the log base 2 of how many steps explicit search could take,
+// trying every input in every state
+func (s Stats) SearchBits() int {
+	return s.Inputs + s.FlipFlops
+}
+
+func (s Stats) String() string {
+	var buf bytes.Buffer
+	fmt.Fprintln(&buf, "Inputs:", s.Inputs)
+	fmt.Fprintln(&buf, "Outputs:", s.Outputs)
+	fmt.Fprintln(&buf, "Flip flops:", s.FlipFlops)
+
+	types := make([]string, 0, len(s.Gates))
+	for t := range s.Gates {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	fmt.Fprintln(&buf, "Gates:")
+	for _, t := range types {
+		fmt.Fprintf(&buf, "  %s: %d\n", t, s.Gates[t])
+	}
+
+	fmt.Fprintln(&buf, "Logic levels:", s.Depth)
+	fmt.Fprintf(&buf, "Fanout: %d max, %.2f average\n", s.MaxFanout, s.AvgFanout)
+	fmt.Fprintf(&buf, "Latch SCCs: %d, the largest with %d flip flops\n", s.SCCs, s.LargestSCC)
+	fmt.Fprintf(&buf, "Explicit search: 2^%d inputs x 2^%d states = %g steps\n", s.Inputs, s.FlipFlops, math.Ldexp(1, s.SearchBits()))
+	fmt.Fprintf(&buf, "CNF per unrolling: %d variables, %d clauses\n", s.CNFVars, s.CNFClauses)
+	return buf.String()
+}
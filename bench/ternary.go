@@ -0,0 +1,177 @@
+package bench
+
+import (
+	"strings"
+)
+
+// In ternary simulation, every value is either known to be off, known to be
+// on, or unknown (X). A gate's output is only unknown when the unknown inputs
+// could change it, so an AND with an input that's off is off no matter what
+// the others are. This is conservative: when an unknown value reaches a gate
+// along two paths that cancel out, like X & !X, the result is still unknown.
+var unknown = outState{unknown: true}
+
+func known(on bool) outState {
+	return outState{on: on}
+}
+
+func (v outState) not() outState {
+	if v.unknown {
+		return v
+	}
+	return known(!v.on)
+}
+
+func (v outState) and(w outState) outState {
+	switch {
+	case !v.unknown && !v.on, !w.unknown && !w.on:
+		return known(false)
+	case v.unknown || w.unknown:
+		return unknown
+	}
+	return known(true)
+}
+
+func (v outState) or(w outState) outState {
+	return v.not().and(w.not()).not()
+}
+
+func (v outState) xor(w outState) outState {
+	if v.unknown || w.unknown {
+		return unknown
+	}
+	return known(v.on != w.on)
+}
+
+// A MUX with an unknown select is only known when both data inputs agree
+func mux(sel, d0, d1 outState) outState {
+	switch {
+	case sel.unknown && d0 == d1:
+		return d0
+	case sel.unknown:
+		return unknown
+	case sel.on:
+		return d1
+	}
+	return d0
+}
+
+// Run through a single step of the circuit in ternary simulation, once the
+// inputs and flip flops are set
+func (r *runner) runTernary() {
+	program := r.b.program
+	for i := range program {
+		r.outState[program[i].out] = r.execTernary(&program[i])
+	}
+}
+
+func (r *runner) execTernary(in *instr) outState {
+	out := known(false)
+	switch in.op {
+	case opAND:
+		out = known(true)
+		for _, id := range in.ins {
+			out = out.and(r.outState[id])
+		}
+	case opOR:
+		for _, id := range in.ins {
+			out = out.or(r.outState[id])
+		}
+	case opXOR:
+		for _, id := range in.ins {
+			out = out.xor(r.outState[id])
+		}
+	case opBUFF:
+		out = r.outState[in.ins[0]]
+	case opMUX:
+		out = mux(r.outState[in.ins[0]], r.outState[in.ins[1]], r.outState[in.ins[2]])
+	case opLUT:
+		out = r.lutTernary(in.mask, in.ins)
+	}
+	if in.invert {
+		return out.not()
+	}
+	return out
+}
+
+// A LUT is known when every row of its truth table that the known inputs
+// allow has the same output
+func (r *runner) lutTernary(mask uint64, ins []int) outState {
+	var c cube
+	for i, in := range ins {
+		if v := r.outState[in]; !v.unknown {
+			c.care |= 1 << uint(i)
+			if v.on {
+				c.value |= 1 << uint(i)
+			}
+		}
+	}
+
+	out := unknown
+	for row := uint(0); row < 1<<uint(len(ins)); row++ {
+		if !c.covers(row) {
+			continue
+		}
+		bit := known(mask>>row&1 == 1)
+		if out.unknown {
+			out = bit
+		} else if bit != out {
+			return unknown
+		}
+	}
+	return out
+}
+
+// NextTernaryState runs a single step of the circuit in ternary simulation,
+// where an X or - in the state or input is a flip flop or input whose value
+// isn't known. The flip flops whose next values depend on the unknown ones
+// come out as X.
+func (b *Bench) NextTernaryState(state, input string) (string, error) {
+	if err := b.checkState(state, ErrInit); err != nil {
+		return "", err
+	}
+	if err := b.checkInputs(input); err != nil {
+		return "", err
+	}
+	r := b.runners[0]
+	r.setInputs(input)
+	r.setState(state)
+	r.runTernary()
+	return r.State(), nil
+}
+
+// TernarySimulate runs the circuit through the inputs one step at a time in
+// ternary simulation, starting from the given state, and returns the state
+// after each step
+func (b *Bench) TernarySimulate(state string, inputs ...string) ([]string, error) {
+	states := make([]string, len(inputs))
+	for i, input := range inputs {
+		var err error
+		if state, err = b.NextTernaryState(state, input); err != nil {
+			return nil, err
+		}
+		states[i] = state
+	}
+	return states, nil
+}
+
+// CheckReset runs the inputs from a state where every flip flop is unknown,
+// and reports whether they leave every flip flop with a known value, so they
+// reset the circuit whatever state it starts in. The trace shows the state
+// after each step, in the same format as Solution. Since ternary simulation
+// is conservative, a sequence that isn't found to reset the circuit might
+// still do it.
+func (b *Bench) CheckReset(inputs ...string) (string, bool, error) {
+	state := strings.Repeat("X", len(b.ffs))
+	states, err := b.TernarySimulate(state, inputs...)
+	if err != nil {
+		return "", false, err
+	}
+
+	steps := make([]State, len(inputs))
+	for i, input := range inputs {
+		steps[i] = State{state: state, input: input}
+		state = states[i]
+	}
+	return b.formatSteps(steps, State{state: state}, false), !strings.Contains(state, "X"), nil
+}
@@ -0,0 +1,95 @@
+package bench
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func identity(bits string) string {
+	return bits
+}
+
+// A group of bits in a trace, which is either a single net or the bits of a
+// bus, most significant first
+type bitGroup struct {
+	label     string
+	positions []int
+}
+
+// Splits a net name like cnt[3] into the bus name and bit, if it has one
+func busBit(name string) (string, int, bool) {
+	open := strings.LastIndex(name, "[")
+	if open < 1 || !strings.HasSuffix(name, "]") {
+		return "", 0, false
+	}
+	bit, err := strconv.Atoi(name[open+1 : len(name)-1])
+	if err != nil {
+		return "", 0, false
+	}
+	return name[:open], bit, true
+}
+
+// Groups the bits of a state or input vector by the gates they come from.
+// The bits of a bus go together, where the bus first shows up, as long as
+// they're a contiguous range.
+func (b *Bench) bitGroups(ids []int) []bitGroup {
+	names := b.gateNames()
+	bits := make(map[string]map[int]int)
+	for pos, id := range ids {
+		if bus, bit, ok := busBit(names[id]); ok {
+			if bits[bus] == nil {
+				bits[bus] = make(map[int]int)
+			}
+			bits[bus][bit] = pos
+		}
+	}
+
+	var groups []bitGroup
+	done := make(map[string]bool)
+	for pos, id := range ids {
+		bus, _, ok := busBit(names[id])
+		if !ok || len(bits[bus]) == 1 {
+			groups = append(groups, bitGroup{label: names[id], positions: []int{pos}})
+			continue
+		}
+		if done[bus] {
+			continue
+		}
+
+		var order []int
+		for bit := range bits[bus] {
+			order = append(order, bit)
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(order)))
+		hi, lo := order[0], order[len(order)-1]
+		if hi-lo+1 != len(order) {
+			groups = append(groups, bitGroup{label: names[id], positions: []int{pos}})
+			continue
+		}
+		done[bus] = true
+		g := bitGroup{label: bus + "[" + strconv.Itoa(hi) + ":" + strconv.Itoa(lo) + "]"}
+		for _, bit := range order {
+			g.positions = append(g.positions, bits[bus][bit])
+		}
+		groups = append(groups, g)
+	}
+	return groups
+}
+
+// A function that formats a state or input vector of the given gates as a
+// list of assignments, like cnt[3:0]=0101 en=1
+func (b *Bench) namer(ids []int) func(string) string {
+	groups := b.bitGroups(ids)
+	return func(bits string) string {
+		parts := make([]string, len(groups))
+		for i, g := range groups {
+			value := make([]byte, len(g.positions))
+			for j, pos := range g.positions {
+				value[j] = bits[pos]
+			}
+			parts[i] = g.label + "=" + string(value)
+		}
+		return strings.Join(parts, " ")
+	}
+}
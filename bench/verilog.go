@@ -0,0 +1,560 @@
+package bench
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// The kinds of problems we can run into reading a Verilog file, on top of the
+// ones checkLines looks for
+var (
+	ErrVerilogSyntax      = errors.New("malformed Verilog")
+	ErrVerilogUnsupported = errors.New("unsupported Verilog construct")
+)
+
+// One bit constants, like 1'b0, or just 1
+var verilogConstRE = regexp.MustCompile(`^(?:1'[bBdDhH])?([01])$`)
+
+// The gate primitives we understand, and the gate type they become
+var verilogPrimitives = map[string]string{
+	"and":  "AND",
+	"or":   "OR",
+	"nand": "NAND",
+	"nor":  "NOR",
+	"xor":  "XOR",
+	"xnor": "XNOR",
+	"not":  "NOT",
+	"buf":  "BUFF",
+}
+
+// The pin names of the flip flop cell. The clock is implied, since every flip
+// flop in a bench file shares the same one.
+var (
+	verilogDataPins  = map[string]bool{"D": true}
+	verilogQPins     = map[string]bool{"Q": true}
+	verilogClockPins = map[string]bool{"C": true, "CK": true, "CLK": true}
+
+	// The enable, reset or set pin of the other flip flop cells
+	verilogControlPins = map[string]map[string]bool{
+		"DFFE": {"E": true, "EN": true},
+		"DFFR": {"R": true, "RST": true, "RESET": true},
+		"DFFS": {"S": true, "SET": true},
+	}
+)
+
+// NewVerilog reads a single flattened module of structural Verilog from r.
+// It understands port, input, output and wire declarations (including
+// vectors, whose bits are named like a[3]), the and, or, nand, nor, xor, xnor,
+// not and buf primitives, continuous assignments of a net or its inverse, and
+// a DFF cell with D and Q pins. DFFE, DFFR and DFFS cells have an E, R or S
+// pin as well, for an enable, synchronous reset or synchronous set. One bit
+// constants like 1'b0 can be used in place of a net. Flip flops can also be
+// connected by position, as (Q, D, CLK) or (Q, D, E, CLK) and so on.
+// Inputs that only drive DFF clock pins are dropped, since they aren't part of
+// the state transition.
+func NewVerilog(r io.Reader, goal string, opts ...Option) (*Bench, error) {
+	bench := newBench(goal, opts)
+	v := &verilogReader{name: bench.name, vectors: make(map[string][2]int), clocks: make(map[string]bool), consts: make(map[string]bool)}
+	if err := v.tokenize(r); err != nil {
+		return nil, err
+	}
+	if err := v.parse(); err != nil {
+		return nil, err
+	}
+
+	bench.lines = v.fileLines()
+	if err := bench.load(); err != nil {
+		return nil, err
+	}
+	return bench, nil
+}
+
+type verilogToken struct {
+	text string
+	line int
+}
+
+type verilogReader struct {
+	name string
+
+	toks []verilogToken
+	pos  int
+
+	// The declared range of each vector net
+	vectors map[string][2]int
+	// Nets connected to a flip flop's clock pin
+	clocks map[string]bool
+	// The constant nets we've made
+	consts map[string]bool
+
+	// Port declarations and everything else, kept apart so that we can drop
+	// clock inputs once we've seen the whole module
+	inputs []fileLine
+	lines  []fileLine
+}
+
+func (v *verilogReader) tokErr(tok verilogToken, err error) error {
+	return &ParseError{File: v.name, Line: tok.line, Text: tok.text, Err: err}
+}
+
+// Splits the source into identifiers, numbers and punctuation, dropping
+// comments and whitespace
+func (v *verilogReader) tokenize(r io.Reader) error {
+	src, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s := string(src)
+	line := 1
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case unicode.IsSpace(rune(c)):
+			i++
+		case strings.HasPrefix(s[i:], "//"):
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(s[i:], "/*"):
+			end := strings.Index(s[i+2:], "*/")
+			if end < 0 {
+				return v.tokErr(verilogToken{"/*", line}, ErrVerilogSyntax)
+			}
+			line += strings.Count(s[i:i+2+end], "\n")
+			i += end + 4
+		case c == '\\':
+			// Escaped identifiers run until whitespace
+			j := i + 1
+			for j < len(s) && !unicode.IsSpace(rune(s[j])) {
+				j++
+			}
+			v.toks = append(v.toks, verilogToken{s[i+1 : j], line})
+			i = j
+		case c == '_' || c == '$' || c == '\'' || unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c)):
+			j := i + 1
+			for j < len(s) && (s[j] == '_' || s[j] == '$' || s[j] == '\'' || unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j]))) {
+				j++
+			}
+			v.toks = append(v.toks, verilogToken{s[i:j], line})
+			i = j
+		default:
+			v.toks = append(v.toks, verilogToken{s[i : i+1], line})
+			i++
+		}
+	}
+	return nil
+}
+
+func (v *verilogReader) peek() verilogToken {
+	if v.pos >= len(v.toks) {
+		line := 0
+		if len(v.toks) > 0 {
+			line = v.toks[len(v.toks)-1].line
+		}
+		return verilogToken{"", line}
+	}
+	return v.toks[v.pos]
+}
+
+func (v *verilogReader) next() verilogToken {
+	tok := v.peek()
+	v.pos++
+	return tok
+}
+
+func (v *verilogReader) expect(text string) error {
+	if tok := v.next(); tok.text != text {
+		return v.tokErr(tok, fmt.Errorf("%w: expected %q", ErrVerilogSyntax, text))
+	}
+	return nil
+}
+
+func isIdent(text string) bool {
+	if text == "" || strings.Contains(text, "'") {
+		return false
+	}
+	c := rune(text[0])
+	return c == '_' || c == '$' || unicode.IsLetter(c)
+}
+
+func (v *verilogReader) ident() (verilogToken, error) {
+	tok := v.next()
+	if !isIdent(tok.text) {
+		return tok, v.tokErr(tok, fmt.Errorf("%w: expected an identifier", ErrVerilogSyntax))
+	}
+	return tok, nil
+}
+
+func (v *verilogReader) parse() error {
+	if err := v.expect("module"); err != nil {
+		return err
+	}
+	if _, err := v.ident(); err != nil {
+		return err
+	}
+
+	// The port list can either be bare names, declared later on, or full
+	// declarations
+	if v.peek().text == "(" {
+		v.next()
+		for v.peek().text != ")" {
+			switch v.peek().text {
+			case "input", "output", "wire":
+				if err := v.declaration(true); err != nil {
+					return err
+				}
+				continue
+			}
+			if _, err := v.ident(); err != nil {
+				return err
+			}
+			if v.peek().text == "," {
+				v.next()
+			}
+		}
+		v.next()
+	}
+	if err := v.expect(";"); err != nil {
+		return err
+	}
+
+	for {
+		tok := v.peek()
+		switch {
+		case tok.text == "endmodule":
+			v.next()
+			if v.pos < len(v.toks) {
+				return v.tokErr(v.peek(), fmt.Errorf("%w: more than one module", ErrVerilogUnsupported))
+			}
+			return nil
+		case tok.text == "":
+			return v.tokErr(tok, fmt.Errorf("%w: expected \"endmodule\"", ErrVerilogSyntax))
+		case tok.text == "input" || tok.text == "output" || tok.text == "wire":
+			if err := v.declaration(false); err != nil {
+				return err
+			}
+		case tok.text == "assign":
+			if err := v.assign(); err != nil {
+				return err
+			}
+		case verilogPrimitives[tok.text] != "":
+			if err := v.primitive(); err != nil {
+				return err
+			}
+		case strings.EqualFold(tok.text, "dff") || verilogControlPins[strings.ToUpper(tok.text)] != nil:
+			if err := v.flipFlop(); err != nil {
+				return err
+			}
+		default:
+			return v.tokErr(tok, ErrVerilogUnsupported)
+		}
+	}
+}
+
+// Reads an optional [msb:lsb] range
+func (v *verilogReader) vectorRange() (r [2]int, isVector bool, err error) {
+	if v.peek().text != "[" {
+		return r, false, nil
+	}
+	v.next()
+	for i := range r {
+		tok := v.next()
+		if r[i], err = strconv.Atoi(tok.text); err != nil {
+			return r, false, v.tokErr(tok, fmt.Errorf("%w: expected a number", ErrVerilogSyntax))
+		}
+		if i == 0 {
+			if err := v.expect(":"); err != nil {
+				return r, false, err
+			}
+		}
+	}
+	return r, true, v.expect("]")
+}
+
+// The names of each bit of a net, from the msb to the lsb
+func vectorBits(name string, r [2]int) []string {
+	var bits []string
+	step := 1
+	if r[0] > r[1] {
+		step = -1
+	}
+	for i := r[0]; ; i += step {
+		bits = append(bits, name+"["+strconv.Itoa(i)+"]")
+		if i == r[1] {
+			return bits
+		}
+	}
+}
+
+// Reads an input, output or wire declaration. Inside an ANSI style port list
+// declarations end at a closing paren or the next declaration instead of a
+// semicolon.
+func (v *verilogReader) declaration(inPortList bool) error {
+	kind := v.next()
+	if v.peek().text == "wire" || v.peek().text == "reg" {
+		v.next()
+	}
+	r, isVector, err := v.vectorRange()
+	if err != nil {
+		return err
+	}
+	for {
+		tok, err := v.ident()
+		if err != nil {
+			return err
+		}
+		name := badNetCharRE.ReplaceAllString(tok.text, "_")
+		bits := []string{name}
+		if isVector {
+			v.vectors[name] = r
+			bits = vectorBits(name, r)
+		}
+		if kind.text != "wire" {
+			gateType := strings.ToUpper(kind.text)
+			for _, bit := range bits {
+				fl := fileLine{output: bit, gateType: gateType, isIO: true, num: tok.line, text: kind.text + " " + tok.text}
+				if gateType == "INPUT" {
+					v.inputs = append(v.inputs, fl)
+				} else {
+					v.lines = append(v.lines, fl)
+				}
+			}
+		}
+
+		switch v.peek().text {
+		case ",":
+			v.next()
+			if inPortList {
+				switch v.peek().text {
+				case "input", "output", "wire":
+					return nil
+				}
+			}
+		case ")":
+			if inPortList {
+				return nil
+			}
+			return v.tokErr(v.next(), ErrVerilogSyntax)
+		default:
+			if inPortList {
+				return v.tokErr(v.next(), ErrVerilogSyntax)
+			}
+			return v.expect(";")
+		}
+	}
+}
+
+// Reads a reference to a single bit net, either a scalar or one bit of a
+// vector
+func (v *verilogReader) net() (string, error) {
+	tok := v.next()
+	if strings.Contains(tok.text, "'") || tok.text == "0" || tok.text == "1" {
+		return v.constant(tok)
+	}
+	if !isIdent(tok.text) {
+		return "", v.tokErr(tok, fmt.Errorf("%w: expected a net", ErrVerilogSyntax))
+	}
+	name := badNetCharRE.ReplaceAllString(tok.text, "_")
+	if v.peek().text == "[" {
+		v.next()
+		bit := v.next()
+		if _, err := strconv.Atoi(bit.text); err != nil {
+			return "", v.tokErr(bit, fmt.Errorf("%w: expected a bit index", ErrVerilogSyntax))
+		}
+		if err := v.expect("]"); err != nil {
+			return "", err
+		}
+		return name + "[" + bit.text + "]", nil
+	}
+	if _, ok := v.vectors[name]; ok {
+		return "", v.tokErr(tok, fmt.Errorf("%w: whole vector connections", ErrVerilogUnsupported))
+	}
+	return name, nil
+}
+
+// Single bit constants become CONST0 and CONST1 gates, which are added the
+// first time they're used
+func (v *verilogReader) constant(tok verilogToken) (string, error) {
+	m := verilogConstRE.FindStringSubmatch(tok.text)
+	if m == nil {
+		return "", v.tokErr(tok, fmt.Errorf("%w: constants wider than one bit", ErrVerilogUnsupported))
+	}
+	name := "$const" + m[1]
+	if !v.consts[name] {
+		v.consts[name] = true
+		v.lines = append(v.lines, fileLine{output: name, gateType: "CONST" + m[1], num: tok.line, text: tok.text})
+	}
+	return name, nil
+}
+
+// assign lhs = rhs; or assign lhs = ~rhs;
+func (v *verilogReader) assign() error {
+	tok := v.next()
+	lhs, err := v.net()
+	if err != nil {
+		return err
+	}
+	if err := v.expect("="); err != nil {
+		return err
+	}
+	gateType := "BUFF"
+	if v.peek().text == "~" {
+		v.next()
+		gateType = "NOT"
+	}
+	rhs, err := v.net()
+	if err != nil {
+		return err
+	}
+	v.lines = append(v.lines, fileLine{output: lhs, inputs: []string{rhs}, gateType: gateType, num: tok.line, text: "assign " + lhs})
+	return v.expect(";")
+}
+
+// Reads the connection list of an instance, either by position or by name.
+// Named connections are returned with the pin names in the second slice.
+func (v *verilogReader) connections() (nets, pins []string, err error) {
+	if err := v.expect("("); err != nil {
+		return nil, nil, err
+	}
+	for {
+		if v.peek().text == "." {
+			v.next()
+			pin, err := v.ident()
+			if err != nil {
+				return nil, nil, err
+			}
+			if err := v.expect("("); err != nil {
+				return nil, nil, err
+			}
+			pins = append(pins, pin.text)
+		}
+		net, err := v.net()
+		if err != nil {
+			return nil, nil, err
+		}
+		nets = append(nets, net)
+		if len(pins) > 0 {
+			if len(pins) != len(nets) {
+				return nil, nil, v.tokErr(v.peek(), fmt.Errorf("%w: mixed named and positional connections", ErrVerilogSyntax))
+			}
+			if err := v.expect(")"); err != nil {
+				return nil, nil, err
+			}
+		}
+		if tok := v.next(); tok.text == ")" {
+			return nets, pins, nil
+		} else if tok.text != "," {
+			return nil, nil, v.tokErr(tok, ErrVerilogSyntax)
+		}
+	}
+}
+
+// Reads one or more instances of the same type, up to the semicolon, calling
+// add for each of them
+func (v *verilogReader) instances(add func(kind verilogToken, nets, pins []string) error) error {
+	kind := v.next()
+	for {
+		// Instance names are optional
+		if isIdent(v.peek().text) {
+			v.next()
+		}
+		nets, pins, err := v.connections()
+		if err != nil {
+			return err
+		}
+		if err := add(kind, nets, pins); err != nil {
+			return err
+		}
+		if v.peek().text != "," {
+			return v.expect(";")
+		}
+		v.next()
+	}
+}
+
+// Gate primitives have their output first, then their inputs
+func (v *verilogReader) primitive() error {
+	return v.instances(func(kind verilogToken, nets, pins []string) error {
+		if len(pins) > 0 || len(nets) < 2 {
+			return v.tokErr(kind, fmt.Errorf("%w: gate primitives need an output and inputs, by position", ErrVerilogSyntax))
+		}
+		gateType := verilogPrimitives[kind.text]
+		v.lines = append(v.lines, fileLine{output: nets[0], inputs: nets[1:], gateType: gateType, num: kind.line, text: kind.text + " " + nets[0]})
+		return nil
+	})
+}
+
+func (v *verilogReader) flipFlop() error {
+	return v.instances(func(kind verilogToken, nets, pins []string) error {
+		cell := strings.ToUpper(kind.text)
+		control := verilogControlPins[cell]
+		// The nets connected to D, then the control pin if there is one
+		ins := make([]string, 1, 2)
+		if control != nil {
+			ins = ins[:2]
+		}
+
+		var q string
+		if len(pins) == 0 {
+			if len(nets) < 1+len(ins) || len(nets) > 2+len(ins) {
+				order := "(Q, D, CLK)"
+				if control != nil {
+					order = "(Q, D, " + cell[3:] + ", CLK)"
+				}
+				return v.tokErr(kind, fmt.Errorf("%w: %s is connected as %s", ErrVerilogSyntax, cell, order))
+			}
+			q = nets[0]
+			copy(ins, nets[1:])
+			if len(nets) == 2+len(ins) {
+				v.clocks[nets[len(nets)-1]] = true
+			}
+		}
+		for i, pin := range pins {
+			switch pin = strings.ToUpper(pin); {
+			case verilogDataPins[pin]:
+				ins[0] = nets[i]
+			case control[pin]:
+				ins[1] = nets[i]
+			case verilogQPins[pin]:
+				q = nets[i]
+			case verilogClockPins[pin]:
+				v.clocks[nets[i]] = true
+			default:
+				return v.tokErr(kind, fmt.Errorf("%w: %s pin %s", ErrVerilogUnsupported, cell, pin))
+			}
+		}
+		for _, in := range ins {
+			if in == "" || q == "" {
+				return v.tokErr(kind, fmt.Errorf("%w: %s needs all of its pins connected", ErrVerilogSyntax, cell))
+			}
+		}
+		v.lines = append(v.lines, fileLine{output: q, inputs: ins, gateType: cell, num: kind.line, text: kind.text + " " + q})
+		return nil
+	})
+}
+
+// The lines of the equivalent bench file, leaving out clock inputs
+func (v *verilogReader) fileLines() []fileLine {
+	read := make(map[string]bool)
+	for _, line := range v.lines {
+		for _, in := range line.inputs {
+			read[in] = true
+		}
+	}
+
+	var lines []fileLine
+	for _, in := range v.inputs {
+		if !v.clocks[in.output] || read[in.output] {
+			lines = append(lines, in)
+		}
+	}
+	return append(lines, v.lines...)
+}
@@ -0,0 +1,83 @@
+package bench
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// The same counter as counterAAG, with the state in a vector
+const counterVerilog = `// A two bit counter
+module counter (clk, en, bad);
+  input clk, en;
+  output bad;
+  wire [1:0] q;
+  wire en_n, q0_n, c, x0, x1, /* unused */ y0;
+
+  not (en_n, en), (q0_n, q[0]);
+  and g0 (x0, q[0], en_n);
+  and g1 (x1, q0_n, en);
+  or g2 (d0, x0, x1);
+  and (c, q[0], en);
+  xor g3 (d1, q[1], c);
+  DFF r0 (.D(d0), .Q(q[0]), .CK(clk));
+  DFF r1 (q[1], d1, clk);
+  assign bad = q[0] & q[1];
+endmodule
+`
+
+func TestVerilog(t *testing.T) {
+	src := strings.Replace(counterVerilog, "assign bad = q[0] & q[1];", "and (bad, q[0], q[1]);", 1)
+	bench, err := NewVerilog(strings.NewReader(src), "11")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The clock only drives flip flops, so it isn't an input
+	if len(bench.inputs) != 1 {
+		t.Errorf("Expected 1 input, Got %d", len(bench.inputs))
+	}
+	for _, name := range []string{"q[0]", "q[1]", "en", "bad"} {
+		if _, ok := bench.gateOutputs[name]; !ok {
+			t.Errorf("Expected a net named %s", name)
+		}
+	}
+
+	tests := []struct {
+		state, input, exp string
+	}{
+		{"00", "0", "00"},
+		{"00", "1", "10"},
+		{"10", "1", "01"},
+		{"11", "1", "00"},
+		{"11", "0", "11"},
+	}
+	for _, test := range tests {
+		if s := bench.NextState(test.state, test.input); s != test.exp {
+			t.Errorf("%s with inputs %s: Expected %s, Got %s", test.state, test.input, test.exp, s)
+		}
+	}
+	checkGateClauses(t, bench)
+}
+
+func TestVerilogErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		line int
+		err  error
+	}{
+		{counterVerilog, 16, ErrVerilogSyntax},
+		{"module m(a, b);\ninput a;\noutput b;\nfoo u (b, a);\nendmodule\n", 4, ErrVerilogUnsupported},
+		{"module m(input a, output b);\nand (b, a, 2'b11);\nendmodule\n", 2, ErrVerilogUnsupported},
+		{"module m(input [1:0] a, output b);\nand (b, a);\nendmodule\n", 2, ErrVerilogUnsupported},
+		{"module m(input a, output b);\nand (b, a, c);\nendmodule\n", 2, ErrUndeclaredInput},
+		{"module m(input a, output b);\nand (b, a, a);\nendmodule\nmodule n;\nendmodule\n", 4, ErrVerilogUnsupported},
+	}
+	for _, test := range tests {
+		_, err := NewVerilog(strings.NewReader(test.src), "")
+		var perr *ParseError
+		if !errors.As(err, &perr) || !errors.Is(err, test.err) || perr.Line != test.line {
+			t.Errorf("%q: Expected %v on line %d, Got %v", test.src, test.err, test.line, err)
+		}
+	}
+}
@@ -0,0 +1,310 @@
+package bench
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// WriteFile writes the circuit to filename, in the format that goes with its
+// extension: .bench, .aag or .v
+func (b *Bench) WriteFile(filename string) error {
+	var write func(io.Writer) error
+	switch filepath.Ext(filename) {
+	case ".bench":
+		write = b.WriteBench
+	case ".aag":
+		write = b.WriteAIGER
+	case ".v":
+		write = b.WriteVerilog
+	default:
+		return fmt.Errorf("don't know how to write %s", filename)
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := write(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// WriteBench writes the circuit out as a bench file, with the inputs and
+// outputs first. Flip flops are annotated with their initial value when there
+// is a single initial state, since a bench file can't hold more than one.
+func (b *Bench) WriteBench(w io.Writer) error {
+	patterns := b.initPatterns()
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "# %s\n", b.name)
+	for _, kind := range []string{"INPUT", "OUTPUT"} {
+		for _, line := range b.lines {
+			if line.gateType == kind {
+				fmt.Fprintln(bw, line)
+			}
+		}
+	}
+	fmt.Fprintln(bw)
+	ff := 0
+	for _, line := range b.lines {
+		if line.isIO {
+			continue
+		}
+		if flipFlops[line.gateType] {
+			line.param = ""
+			if len(patterns) == 1 && patterns[0][ff] != '0' {
+				line.param = patterns[0][ff : ff+1]
+			}
+			ff++
+		}
+		fmt.Fprintln(bw, line)
+	}
+	return bw.Flush()
+}
+
+// WriteAIGER writes the circuit out in the ASCII AIGER format, as an
+// and-inverter graph with a symbol table holding the original net names.
+// Flip flops that can start with either value become uninitialized latches,
+// but AIGER has no way to give more than one initial state.
+func (b *Bench) WriteAIGER(w io.Writer) error {
+	patterns := b.initPatterns()
+	if len(patterns) > 1 {
+		return fmt.Errorf("%w: AIGER files have a single initial state", ErrInit)
+	}
+	g, lits := b.toAIG()
+	names := b.gateNames()
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "aag %d %d %d %d %d\n", g.maxVar(), len(b.inputs), len(b.ffs), len(b.outputs), len(g.ands))
+	for _, id := range b.inputs {
+		fmt.Fprintln(bw, lits[id])
+	}
+	for i, id := range b.ffs {
+		reset := string(patterns[0][i])
+		if reset == "X" {
+			reset = strconv.Itoa(lits[id])
+		}
+		fmt.Fprintf(bw, "%d %d %s\n", lits[id], g.next[i], reset)
+	}
+	for _, out := range b.outputs {
+		fmt.Fprintln(bw, lits[b.gateOutputs[out]])
+	}
+	for i, and := range g.ands {
+		fmt.Fprintf(bw, "%d %d %d\n", 2*(len(b.inputs)+len(b.ffs)+i+1), and[0], and[1])
+	}
+
+	for i, id := range b.inputs {
+		fmt.Fprintf(bw, "i%d %s\n", i, names[id])
+	}
+	for i, id := range b.ffs {
+		fmt.Fprintf(bw, "l%d %s\n", i, names[id])
+	}
+	for i, out := range b.outputs {
+		fmt.Fprintf(bw, "o%d %s\n", i, out)
+	}
+	return bw.Flush()
+}
+
+// Names that can be written as is in Verilog, anything else gets escaped
+var verilogIdentRE = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_$]*$`)
+
+func verilogName(name string) string {
+	if verilogIdentRE.MatchString(name) {
+		return name
+	}
+	// Escaped identifiers end at whitespace
+	return "\\" + name + " "
+}
+
+// WriteVerilog writes the circuit out as a structural Verilog module, in the
+// subset that NewVerilog reads. The module is named after the netlist, and
+// gets a clock input if it has any flip flops, which have no initial value.
+// MUXes and LUTs are built out of and, or and not primitives, with wires of
+// their own for the pieces.
+func (b *Bench) WriteVerilog(w io.Writer) error {
+	module := strings.TrimSuffix(filepath.Base(b.name), filepath.Ext(b.name))
+	module = badNetCharRE.ReplaceAllString(module, "_")
+	if !verilogIdentRE.MatchString(module) {
+		module = "top"
+	}
+
+	var ports, inputs, outputs, wires []string
+	for _, line := range b.lines {
+		switch line.gateType {
+		case "INPUT":
+			inputs = append(inputs, verilogName(line.output))
+		case "OUTPUT":
+			outputs = append(outputs, verilogName(line.output))
+		}
+	}
+	isPort := make(map[string]bool)
+	for _, name := range append(inputs, outputs...) {
+		isPort[name] = true
+	}
+	for _, line := range b.lines {
+		if !line.isIO && !isPort[verilogName(line.output)] {
+			wires = append(wires, verilogName(line.output))
+		}
+	}
+
+	clock := ""
+	if len(b.ffs) > 0 {
+		clock = "clk"
+		for _, ok := b.gateOutputs[clock]; ok; _, ok = b.gateOutputs[clock] {
+			clock += "_"
+		}
+		inputs = append([]string{clock}, inputs...)
+	}
+	ports = append(ports, inputs...)
+	ports = append(ports, outputs...)
+
+	// The gates are written first, since MUXes and LUTs need more wires
+	body := &verilogBody{taken: map[string]bool{clock: true}}
+	for name := range b.gateOutputs {
+		body.taken[name] = true
+	}
+	ffs := 0
+	for _, line := range b.lines {
+		if line.isIO {
+			continue
+		}
+		nets := make([]string, len(line.inputs))
+		for i, in := range line.inputs {
+			nets[i] = verilogName(in)
+		}
+		out := verilogName(line.output)
+		switch line.gateType {
+		case "DFF":
+			fmt.Fprintf(&body.buf, "  DFF r%d (.D(%s), .Q(%s), .CK(%s));\n", ffs, nets[0], out, clock)
+			ffs++
+		case "DFFE", "DFFR", "DFFS":
+			pin := line.gateType[len(line.gateType)-1:]
+			fmt.Fprintf(&body.buf, "  %s r%d (.D(%s), .%s(%s), .Q(%s), .CK(%s));\n", line.gateType, ffs, nets[0], pin, nets[1], out, clock)
+			ffs++
+		case "CONST0", "GND":
+			fmt.Fprintf(&body.buf, "  assign %s = 1'b0;\n", out)
+		case "CONST1", "VDD":
+			fmt.Fprintf(&body.buf, "  assign %s = 1'b1;\n", out)
+		case "MUX":
+			body.mux(line.output, nets[0], nets[1], nets[2])
+		case "LUT":
+			mask, _ := parseMask(line.param)
+			body.lut(line.output, mask, nets)
+		default:
+			body.gate(verilogGateName(line.gateType), out, nets...)
+		}
+	}
+	wires = append(wires, body.wires...)
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "module %s (%s);\n", module, strings.Join(ports, ", "))
+	for _, decl := range []struct {
+		kind  string
+		names []string
+	}{{"input", inputs}, {"output", outputs}, {"wire", wires}} {
+		for _, name := range decl.names {
+			fmt.Fprintf(bw, "  %s %s;\n", decl.kind, name)
+		}
+	}
+	fmt.Fprintln(bw)
+	bw.Write(body.buf.Bytes())
+	fmt.Fprintln(bw, "endmodule")
+	return bw.Flush()
+}
+
+// The gates of a Verilog module, along with the wires made up for the pieces
+// of MUXes and LUTs
+type verilogBody struct {
+	buf   bytes.Buffer
+	gates int
+
+	// The names already used by nets, and the wires we've added
+	taken map[string]bool
+	wires []string
+}
+
+func (v *verilogBody) gate(prim, out string, ins ...string) {
+	fmt.Fprintf(&v.buf, "  %s g%d (%s, %s);\n", prim, v.gates, out, strings.Join(ins, ", "))
+	v.gates++
+}
+
+// A new wire for part of the logic driving net, named like net_0
+func (v *verilogBody) wire(net string) string {
+	name := net
+	for i := 0; v.taken[name]; i++ {
+		name = net + "_" + strconv.Itoa(i)
+	}
+	v.taken[name] = true
+	v.wires = append(v.wires, verilogName(name))
+	return verilogName(name)
+}
+
+// A MUX picks d1 when sel is on, and d0 otherwise
+func (v *verilogBody) mux(net, sel, d0, d1 string) {
+	selN, t0, t1 := v.wire(net), v.wire(net), v.wire(net)
+	v.gate("not", selN, sel)
+	v.gate("and", t0, selN, d0)
+	v.gate("and", t1, sel, d1)
+	v.gate("or", verilogName(net), t0, t1)
+}
+
+// A LUT is the or of the products in a cover of its truth table
+func (v *verilogBody) lut(net string, mask uint64, ins []string) {
+	out := verilogName(net)
+	inverted := make([]string, len(ins))
+	var terms []string
+	for _, c := range lutCover(mask, len(ins), true) {
+		var lits []string
+		for i, in := range ins {
+			if c.care&(1<<uint(i)) == 0 {
+				continue
+			}
+			if c.value&(1<<uint(i)) == 0 {
+				if inverted[i] == "" {
+					inverted[i] = v.wire(net)
+					v.gate("not", inverted[i], in)
+				}
+				in = inverted[i]
+			}
+			lits = append(lits, in)
+		}
+		switch len(lits) {
+		case 0:
+			// Only a LUT that's always on has a product with no inputs
+			fmt.Fprintf(&v.buf, "  assign %s = 1'b1;\n", out)
+			return
+		case 1:
+			terms = append(terms, lits[0])
+		default:
+			term := v.wire(net)
+			v.gate("and", term, lits...)
+			terms = append(terms, term)
+		}
+	}
+	switch len(terms) {
+	case 0:
+		fmt.Fprintf(&v.buf, "  assign %s = 1'b0;\n", out)
+	case 1:
+		v.gate("buf", out, terms[0])
+	default:
+		v.gate("or", out, terms...)
+	}
+}
+
+// The Verilog primitive for a bench gate type
+func verilogGateName(gateType string) string {
+	for prim, gt := range verilogPrimitives {
+		if gt == gateType {
+			return prim
+		}
+	}
+	return strings.ToLower(gateType)
+}
@@ -0,0 +1,136 @@
+package bench
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+const wideBench = `INPUT(A)
+INPUT(B)
+INPUT(C)
+OUTPUT(G5)
+Q0 = DFF(G0)
+Q1 = DFF(G1)
+Q2 = DFF(G4)
+G0 = AND(A, Q1, C)
+G1 = NOR(A, B, Q2)
+G2 = NAND(Q0, G1)
+G3 = XOR(G2, B, Q0, Q1)
+G4 = XNOR(G3, C)
+G5 = OR(G4, G2, T)
+T = GND()
+`
+
+// MUXes and LUTs, including ones that are constant or just pass an input on
+const muxLUTBench = `INPUT(A)
+INPUT(B)
+INPUT(S)
+OUTPUT(m[0])
+Q0 = DFF(m[0])
+Q1 = DFF(L0)
+Q2 = DFFE(L1, S)
+Q3 = DFF(L2)
+m[0] = MUX(S, A, Q1)
+m_0 = MUX(Q0, m[0], B)
+L0 = LUT 0x96e8 (A, m_0, Q2, S)
+L1 = LUT 0xa (Q3, B)
+L2 = LUT 0x0 (A)
+L3 = LUT 0xf (A, B)
+L4 = LUT 0x1 (Q0, L3)
+`
+
+func TestWriters(t *testing.T) {
+	blif, err := NewBLIF(strings.NewReader(counterBLIF), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, bench := range []*Bench{loadTestBench(t, wideBench, ""), loadTestBench(t, muxLUTBench, ""), blif} {
+		writers := []struct {
+			write func(*bytes.Buffer) error
+			read  func(*bytes.Buffer) (*Bench, error)
+		}{
+			{
+				func(buf *bytes.Buffer) error { return bench.WriteBench(buf) },
+				func(buf *bytes.Buffer) (*Bench, error) { return New(buf, "") },
+			},
+			{
+				func(buf *bytes.Buffer) error { return bench.WriteAIGER(buf) },
+				func(buf *bytes.Buffer) (*Bench, error) { return NewAIGER(buf, "") },
+			},
+			{
+				func(buf *bytes.Buffer) error { return bench.WriteVerilog(buf) },
+				func(buf *bytes.Buffer) (*Bench, error) { return NewVerilog(buf, "") },
+			},
+		}
+		for _, w := range writers {
+			var buf bytes.Buffer
+			if err := w.write(&buf); err != nil {
+				t.Fatal(err)
+			}
+			src := buf.String()
+			read, err := w.read(&buf)
+			if err != nil {
+				t.Fatalf("%v reading back:\n%s", err, src)
+			}
+			if err := sameTransitions(bench, read); err != nil {
+				t.Errorf("%v in:\n%s", err, src)
+			}
+			if strings.HasPrefix(src, "aag") && read.initPatterns()[0] != bench.initPatterns()[0] {
+				t.Errorf("Expected initial state %s, Got %s", bench.initPatterns()[0], read.initPatterns()[0])
+			}
+		}
+	}
+}
+
+// sameTransitions checks that two circuits go to the same next state for every
+// state and input
+func sameTransitions(a, b *Bench) error {
+	if len(a.ffs) != len(b.ffs) || len(a.inputs) != len(b.inputs) {
+		return fmt.Errorf("Expected %d inputs and %d flip flops, Got %d and %d", len(a.inputs), len(a.ffs), len(b.inputs), len(b.ffs))
+	}
+	nIn, nFF := len(a.inputs), len(a.ffs)
+	for i := 0; i < 1<<uint(nIn+nFF); i++ {
+		bits := fmt.Sprintf("%0*b", nIn+nFF, i)
+		state, input := bits[nIn:], bits[:nIn]
+		if x, y := a.NextState(state, input), b.NextState(state, input); x != y {
+			return fmt.Errorf("%s with inputs %s: Expected %s, Got %s", state, input, x, y)
+		}
+	}
+	return nil
+}
+
+func TestWriteDOT(t *testing.T) {
+	bench := loadTestBench(t, wideBench, "")
+	var buf bytes.Buffer
+	if err := bench.WriteDOT(&buf, "Q0"); err != nil {
+		t.Fatal(err)
+	}
+	dot := buf.String()
+
+	// Q0 only depends on A, C, Q1 and through it B and Q2
+	for _, name := range []string{"A", "B", "C", "Q0", "Q1", "Q2", "G0", "G1", "G4"} {
+		if !strings.Contains(dot, "\\n"+name+"\", shape") || !regexpMatch(t, `\\n`+name+`", [^\]]*color=red`, dot) {
+			t.Errorf("Expected %s to be highlighted", name)
+		}
+	}
+	if regexpMatch(t, `\\nG5", [^\]]*color=red`, dot) {
+		t.Error("Expected G5 not to be highlighted")
+	}
+	if !strings.Contains(dot, "style=dashed") {
+		t.Error("Expected dashed feedback edges")
+	}
+	if err := bench.WriteDOT(&buf, "G5"); err == nil {
+		t.Error("Expected an error highlighting a gate that isn't a flip flop")
+	}
+}
+
+func regexpMatch(t *testing.T, re, s string) bool {
+	ok, err := regexp.MatchString(re, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ok
+}
@@ -4,7 +4,9 @@ import (
 	"./bench"
 	"flag"
 	"fmt"
+	"os"
 	"runtime"
+	"strings"
 )
 
 var (
@@ -12,11 +14,21 @@ var (
 	logLevel int
 	nUnroll  int
 
-	inputFile string
+	inputFile  string
+	outputFile string
+	dotFile    string
+	cone       string
+	initStates string
+	resetSeq   string
 
 	explicit bool
 	symbolic bool
 	count    bool
+	stats    bool
+	reduce   bool
+	optimize bool
+	selfTest bool
+	names    bool
 )
 
 func init() {
@@ -26,10 +38,20 @@ func init() {
 	flag.IntVar(&nUnroll, "unroll", 2, "how many times to unroll the formula")
 
 	flag.StringVar(&inputFile, "input", "bench/ex1", "bench file to parse")
+	flag.StringVar(&outputFile, "output", "", "write the circuit to this .bench, .aag or .v file")
+	flag.StringVar(&dotFile, "dot", "", "draw the circuit as a Graphviz graph in this file")
+	flag.StringVar(&initStates, "init", "", "comma separated initial states, with a 0, 1 or X for each flip flop")
+	flag.StringVar(&resetSeq, "reset", "", "comma separated inputs to check for resetting the circuit from an unknown state")
+	flag.StringVar(&cone, "cone", "", "comma separated flip flops whose cone of influence is highlighted in the graph")
 
 	flag.BoolVar(&explicit, "e", false, "run explicit search on the input file")
 	flag.BoolVar(&count, "c", false, "explicitly search for all reachable states and return a count")
 	flag.BoolVar(&symbolic, "s", false, "run symbolic search on the input file")
+	flag.BoolVar(&reduce, "coi", true, "cut the circuit down to the cone of influence of the goals before searching")
+	flag.BoolVar(&optimize, "opt", false, "merge duplicate gates, fold constants and remove dangling logic, and report how much went")
+	flag.BoolVar(&selfTest, "opt-check", false, "check that the optimized circuit is equivalent to the original one")
+	flag.BoolVar(&stats, "stats", false, "print the size of the circuit and estimates of the search cost")
+	flag.BoolVar(&names, "names", false, "print traces as named flip flops and inputs, with buses grouped together")
 
 	flag.Parse()
 
@@ -37,14 +59,70 @@ func init() {
 	runtime.GOMAXPROCS(runtime.NumCPU())
 }
 func main() {
-	b, _ := bench.NewFromFile(inputFile, nRunners)
-	b.LogLevel = logLevel
-	b.Unroll = nUnroll
+	opts := []bench.Option{bench.WithUnroll(nUnroll), bench.WithLogLevel(logLevel)}
+	if initStates != "" {
+		opts = append(opts, bench.WithInit(strings.Split(initStates, ",")...))
+	}
+	if names {
+		opts = append(opts, bench.WithNamedTraces())
+	}
+	b, err := bench.NewFromFile(inputFile, nRunners, opts...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if optimize {
+		opt, report, err := b.Optimize()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Print(report)
+		if selfTest {
+			if err := b.CheckEquivalent(opt); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			fmt.Println("Optimized circuit is equivalent")
+		}
+		b = opt
+	}
+	if dotFile != "" {
+		if err := writeDOT(b); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	if outputFile != "" {
+		if err := b.WriteFile(outputFile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	if stats {
+		fmt.Print(b.Stats())
+	}
+	if resetSeq != "" {
+		trace, ok, err := b.CheckReset(strings.Split(resetSeq, ",")...)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Println("Resets the circuit:", ok)
+		fmt.Print(trace)
+	}
+	// Counting states needs every flip flop
+	if reduce && !count {
+		if b, err = b.Reduce(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
 	if explicit && count {
 		reachable := b.ReachableStates()
 		var isReachable bool
 		for state := range reachable {
-			if state == b.Goal {
+			if b.IsGoal(state) {
 				isReachable = true
 				break
 			}
@@ -54,6 +132,8 @@ func main() {
 		if isReachable {
 			fmt.Println(b.Solution(reachable))
 		}
+	} else if explicit && !count && b.GoalCount() > 1 {
+		fmt.Print(bench.Report(b.CheckGoals()))
 	} else if explicit && !count {
 		isReachable, reachable := b.IsReachable()
 		fmt.Println("Explicitly reachable:", isReachable)
@@ -66,7 +146,10 @@ func main() {
 		fmt.Println("Total reachable states:", len(reachable))
 	}
 
-	if symbolic {
+	if symbolic && b.GoalCount() > 1 {
+		fmt.Println("Symbolically reachable in", nUnroll, "unrollings:")
+		fmt.Print(bench.Report(b.SatGoals()))
+	} else if symbolic {
 		sat, sol := b.Sat()
 		fmt.Println("Symbolically reachable in", nUnroll, "unrollings:", sat)
 		if sat {
@@ -74,3 +157,19 @@ func main() {
 		}
 	}
 }
+
+func writeDOT(b *bench.Bench) error {
+	var highlight []string
+	if cone != "" {
+		highlight = strings.Split(cone, ",")
+	}
+	file, err := os.Create(dotFile)
+	if err != nil {
+		return err
+	}
+	if err := b.WriteDOT(file, highlight...); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}